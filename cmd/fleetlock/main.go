@@ -4,6 +4,8 @@ import (
 	"flag"
 	"fmt"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/sirupsen/logrus"
 
@@ -20,12 +22,36 @@ var (
 func main() {
 	flags := struct {
 		address  string
+		backend  string
+		filePath string
+		config   string
+		matchers string
+		diagnose bool
 		logLevel string
 		version  bool
 		help     bool
+		// etcd backend
+		etcdEndpoints string
+		etcdPrefix    string
+		etcdLeaseTTL  time.Duration
+		etcdCAFile    string
+		etcdCertFile  string
+		etcdKeyFile   string
 	}{}
 
 	flag.StringVar(&flags.address, "address", "0.0.0.0:8080", "HTTP listen address")
+	flag.StringVar(&flags.backend, "backend", "kubernetes", "Lock storage backend (kubernetes, memory, file, etcd)")
+	flag.StringVar(&flags.filePath, "file-path", "/var/lib/fleetlock/locks.json", "Lock file path for the file backend")
+	// etcd backend
+	flag.StringVar(&flags.etcdEndpoints, "etcd-endpoints", "http://127.0.0.1:2379", "Comma separated etcd endpoints for the etcd backend")
+	flag.StringVar(&flags.etcdPrefix, "etcd-prefix", "/fleetlock/groups", "etcd key prefix for the etcd backend")
+	flag.DurationVar(&flags.etcdLeaseTTL, "etcd-lease-ttl", 0, "etcd lease TTL after which held locks expire (optional)")
+	flag.StringVar(&flags.etcdCAFile, "etcd-ca-file", "", "etcd CA certificate file (optional)")
+	flag.StringVar(&flags.etcdCertFile, "etcd-cert-file", "", "etcd client certificate file (optional)")
+	flag.StringVar(&flags.etcdKeyFile, "etcd-key-file", "", "etcd client key file (optional)")
+	flag.StringVar(&flags.config, "config", "", "Path to reboot group configuration file")
+	flag.StringVar(&flags.matchers, "node-matchers", strings.Join(fleetlock.DefaultMatchers, ","), "Comma separated strategies to match Zincati requests to Nodes (machine-id, system-uuid, annotation)")
+	flag.BoolVar(&flags.diagnose, "diagnostics", false, "Serve Node matching diagnostics at /-/nodes (exposes Node MachineIDs)")
 	// log levels https://github.com/sirupsen/logrus/blob/master/logrus.go#L36
 	flag.StringVar(&flags.logLevel, "log-level", "info", "Set the logging level")
 	// subcommands
@@ -52,9 +78,31 @@ func main() {
 	}
 	log.Level = lvl
 
+	// reboot groups
+	var groups *fleetlock.Groups
+	if flags.config != "" {
+		groups, err = fleetlock.LoadGroups(flags.config)
+		if err != nil {
+			log.Fatalf("main: LoadGroups error: %v", err)
+		}
+	}
+
 	// HTTP Server
 	config := &fleetlock.Config{
-		Logger: log,
+		Logger:      log,
+		Groups:      groups,
+		Backend:     flags.backend,
+		FilePath:    flags.filePath,
+		Matchers:    strings.Split(flags.matchers, ","),
+		Diagnostics: flags.diagnose,
+		Etcd: &fleetlock.EtcdConfig{
+			Endpoints: strings.Split(flags.etcdEndpoints, ","),
+			Prefix:    flags.etcdPrefix,
+			LeaseTTL:  flags.etcdLeaseTTL,
+			CAFile:    flags.etcdCAFile,
+			CertFile:  flags.etcdCertFile,
+			KeyFile:   flags.etcdKeyFile,
+		},
 	}
 	server, err := fleetlock.NewServer(config)
 	if err != nil {
@@ -0,0 +1,29 @@
+package fleetlock
+
+import (
+	"github.com/sirupsen/logrus"
+	"k8s.io/api/core/v1"
+)
+
+// assignGroup returns the group of a request, which may be assigned by the
+// matched Node's group label according to the group policy. Requests without
+// a labeled Node keep the client-supplied group.
+func (s *Server) assignGroup(node *v1.Node, group string, fields logrus.Fields) (string, error) {
+	labeled, ok := s.groups.labeledGroup(node)
+	if !ok || labeled == group {
+		return group, nil
+	}
+
+	fields["labeledGroup"] = labeled
+	switch s.groups.GroupPolicy {
+	case GroupPolicyIgnore:
+		fields["group"] = labeled
+		return labeled, nil
+	case GroupPolicyValidate:
+		return group, deny(KindGroupMismatch, "group %s doesn't match node %s group %s (label %s)", group, node.GetName(), labeled, s.groups.GroupLabel)
+	default:
+		s.log.WithFields(fields).Info("fleetlock: assign group from node group label")
+		fields["group"] = labeled
+		return labeled, nil
+	}
+}
@@ -0,0 +1,55 @@
+package fleetlock
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/api/core/v1"
+)
+
+func TestAssignGroup(t *testing.T) {
+	labeled := testNode(0)
+	labeled.Labels = map[string]string{"node.kubernetes.io/role": "workers"}
+	unlabeled := testNode(1)
+
+	cases := []struct {
+		groups   *Groups
+		node     *v1.Node
+		group    string
+		expected string
+		mismatch bool
+	}{
+		// no group label configured
+		{nil, &labeled, "default", "default", false},
+		{&Groups{}, &labeled, "default", "default", false},
+		// Node unmatched or without the label
+		{&Groups{GroupLabel: "node.kubernetes.io/role"}, nil, "default", "default", false},
+		{&Groups{GroupLabel: "node.kubernetes.io/role", GroupPolicy: GroupPolicyValidate}, &unlabeled, "default", "default", false},
+		// client group matches the label
+		{&Groups{GroupLabel: "node.kubernetes.io/role", GroupPolicy: GroupPolicyValidate}, &labeled, "workers", "workers", false},
+		// client group differs from the label
+		{&Groups{GroupLabel: "node.kubernetes.io/role"}, &labeled, "default", "workers", false},
+		{&Groups{GroupLabel: "node.kubernetes.io/role", GroupPolicy: GroupPolicyOverride}, &labeled, "default", "workers", false},
+		{&Groups{GroupLabel: "node.kubernetes.io/role", GroupPolicy: GroupPolicyIgnore}, &labeled, "default", "workers", false},
+		{&Groups{GroupLabel: "node.kubernetes.io/role", GroupPolicy: GroupPolicyValidate}, &labeled, "default", "default", true},
+	}
+
+	for _, c := range cases {
+		s := &Server{
+			log:    logrus.New(),
+			groups: c.groups,
+		}
+		group, err := s.assignGroup(c.node, c.group, logrus.Fields{})
+		assert.Equal(t, c.expected, group)
+
+		var denied *denial
+		if c.mismatch {
+			assert.True(t, errors.As(err, &denied))
+			assert.Equal(t, KindGroupMismatch, denied.reply.Kind)
+		} else {
+			assert.Nil(t, err)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package fleetlock
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// budget summarizes the availability of a group's Kubernetes Nodes.
+type budget struct {
+	// number of Nodes in the group
+	total int
+	// maximum number of unavailable Nodes
+	allowed int
+	// names of unavailable Nodes
+	unavailable []string
+}
+
+// Exhausted returns true if no more Nodes may become unavailable.
+func (b *budget) Exhausted() bool {
+	return len(b.unavailable) >= b.allowed
+}
+
+// String describes the budget for replies and logs.
+func (b *budget) String() string {
+	return fmt.Sprintf("%d of %d nodes unavailable (max %d): %s", len(b.unavailable), b.total, b.allowed, strings.Join(b.unavailable, ", "))
+}
+
+// unavailableBudget lists the Kubernetes Nodes in a group and computes the
+// budget of Nodes that may be unavailable.
+func (s *Server) unavailableBudget(ctx context.Context, config *GroupConfig, lock *RebootLock, id string) (*budget, error) {
+	nodes, err := s.listNodes(ctx, config.NodeSelector)
+	if err != nil {
+		return nil, err
+	}
+	return newBudget(nodes, s.matchers, config.MaxUnavailable, lock, id)
+}
+
+// newBudget computes the budget of Nodes that may be unavailable. Nodes that
+// are NotReady, cordoned, or hold a reboot slot count as unavailable. The Node
+// matching the requesting id is excluded, since it's the one to be evaluated.
+// Nodes are identified by their Zincati ID under each matching strategy.
+func newBudget(nodes []v1.Node, matchers []string, maxUnavailable *intstr.IntOrString, lock *RebootLock, id string) (*budget, error) {
+	allowed, err := intstr.GetScaledValueFromIntOrPercent(maxUnavailable, len(nodes), false)
+	if err != nil {
+		return nil, err
+	}
+	// allow at least one Node to reboot when a percentage rounds down to zero
+	if allowed < 1 && maxUnavailable.Type == intstr.String {
+		allowed = 1
+	}
+
+	b := &budget{
+		total:       len(nodes),
+		allowed:     allowed,
+		unavailable: []string{},
+	}
+
+	for _, node := range nodes {
+		requesting, holding := false, false
+		for _, strategy := range matchers {
+			if zincatiID, ok := nodeZincatiID(&node, strategy, ZincatiID); ok {
+				requesting = requesting || zincatiID == id
+				holding = holding || lock.Holds(zincatiID)
+			}
+		}
+		if requesting {
+			continue
+		}
+
+		if node.Spec.Unschedulable || !isNodeReady(&node) || holding {
+			b.unavailable = append(b.unavailable, node.GetName())
+		}
+	}
+	return b, nil
+}
+
+// isNodeReady returns true if a Node has a Ready condition that is true.
+func isNodeReady(node *v1.Node) bool {
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == v1.NodeReady {
+			return condition.Status == v1.ConditionTrue
+		}
+	}
+	return false
+}
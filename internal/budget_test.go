@@ -0,0 +1,110 @@
+package fleetlock
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// testNode returns a Ready Node with a machine ID derived from its index.
+func testNode(i int) v1.Node {
+	return v1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: fmt.Sprintf("node-%d", i),
+		},
+		Status: v1.NodeStatus{
+			NodeInfo: v1.NodeSystemInfo{
+				MachineID: fmt.Sprintf("%032x", i),
+			},
+			Conditions: []v1.NodeCondition{
+				{Type: v1.NodeReady, Status: v1.ConditionTrue},
+			},
+		},
+	}
+}
+
+func TestBudget(t *testing.T) {
+	nodes := []v1.Node{}
+	for i := 0; i < 20; i++ {
+		nodes = append(nodes, testNode(i))
+	}
+	// node-1 is NotReady, node-2 is cordoned
+	nodes[1].Status.Conditions[0].Status = v1.ConditionFalse
+	nodes[2].Spec.Unschedulable = true
+
+	id, _ := ZincatiID(nodes[0].Status.NodeInfo.MachineID)
+	holder, _ := ZincatiID(nodes[3].Status.NodeInfo.MachineID)
+
+	cases := []struct {
+		name           string
+		maxUnavailable intstr.IntOrString
+		lock           *RebootLock
+		unavailable    []string
+		exhausted      bool
+	}{
+		{
+			name:           "percent-available",
+			maxUnavailable: intstr.FromString("20%"),
+			lock:           &RebootLock{},
+			unavailable:    []string{"node-1", "node-2"},
+			exhausted:      false,
+		},
+		{
+			name:           "percent-exhausted",
+			maxUnavailable: intstr.FromString("10%"),
+			lock:           &RebootLock{},
+			unavailable:    []string{"node-1", "node-2"},
+			exhausted:      true,
+		},
+		{
+			name:           "holders-unavailable",
+			maxUnavailable: intstr.FromInt(3),
+			lock:           &RebootLock{Holders: []Holder{{ID: holder}}},
+			unavailable:    []string{"node-1", "node-2", "node-3"},
+			exhausted:      true,
+		},
+		{
+			name:           "at-least-one",
+			maxUnavailable: intstr.FromString("1%"),
+			lock:           &RebootLock{},
+			unavailable:    []string{"node-1", "node-2"},
+			exhausted:      true,
+		},
+		{
+			name:           "explicit-zero",
+			maxUnavailable: intstr.FromInt(0),
+			lock:           &RebootLock{},
+			unavailable:    []string{"node-1", "node-2"},
+			exhausted:      true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			b, err := newBudget(nodes, DefaultMatchers, &c.maxUnavailable, c.lock, id)
+			assert.Nil(t, err)
+			assert.Equal(t, 20, b.total)
+			assert.Equal(t, c.unavailable, b.unavailable)
+			assert.Equal(t, c.exhausted, b.Exhausted())
+		})
+	}
+
+	// requesting node counts as available
+	b, err := newBudget(nodes[:1], DefaultMatchers, &cases[0].maxUnavailable, &RebootLock{}, id)
+	assert.Nil(t, err)
+	assert.False(t, b.Exhausted())
+
+	// Nodes are recognized by any matching strategy's Zincati ID
+	nodes[0].Spec.Unschedulable = true
+	nodes[0].Status.NodeInfo.SystemUUID = "ec2a5b8e-62d1-4a2b-9c8f-0d6a4a1e3c71"
+	nodes[3].Annotations = map[string]string{ZincatiIDAnnotation: "annotated"}
+	uuidID, _ := ZincatiID(nodes[0].Status.NodeInfo.SystemUUID)
+	lock := &RebootLock{Holders: []Holder{{ID: "annotated"}}}
+	b, err = newBudget(nodes, DefaultMatchers, &cases[0].maxUnavailable, lock, uuidID)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"node-1", "node-2", "node-3"}, b.unavailable)
+}
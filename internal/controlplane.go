@@ -0,0 +1,264 @@
+package fleetlock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// controlPlaneGroup is the reserved lock group that serializes control plane
+// Node reboots across groups. Its single holder is the rebooting control plane
+// Node.
+const controlPlaneGroup = "fleetlock-control-plane"
+
+// orphanedHoldAge is how long a control plane hold may exist without a hold in
+// any group (e.g. if fleetlock restarted in between) before it's released.
+const orphanedHoldAge = 1 * time.Minute
+
+// controlPlaneLabels are Node labels that identify control plane Nodes,
+// unless set to "false" (e.g. Typhoon's node.kubernetes.io/controller).
+var controlPlaneLabels = []string{
+	"node-role.kubernetes.io/control-plane",
+	"node-role.kubernetes.io/controller",
+	"node-role.kubernetes.io/master",
+	"node.kubernetes.io/controller",
+}
+
+// controlPlaneTaints are Node taint keys that identify control plane Nodes.
+var controlPlaneTaints = []string{
+	"node-role.kubernetes.io/control-plane",
+	"node-role.kubernetes.io/controller",
+	"node-role.kubernetes.io/master",
+}
+
+// osVersionPattern matches the version in a Node OS image (e.g. "Fedora
+// CoreOS 40.20240416.3.1" or "Flatcar Container Linux by Kinvolk 3815.2.0").
+var osVersionPattern = regexp.MustCompile(`\b\d+(\.\d+)+\b`)
+
+// isControlPlane returns true if a Node has a control plane label or taint.
+func isControlPlane(node *v1.Node) bool {
+	for _, key := range controlPlaneLabels {
+		if value, ok := node.GetLabels()[key]; ok && value != "false" {
+			return true
+		}
+	}
+	for _, taint := range node.Spec.Taints {
+		for _, key := range controlPlaneTaints {
+			if taint.Key == key {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// compareOSImages compares the versions in two Node OS images, returning -1,
+// 0, or 1. Images without a version are compared as strings.
+func compareOSImages(a, b string) int {
+	va, vb := osVersionPattern.FindString(a), osVersionPattern.FindString(b)
+	if va == "" || vb == "" {
+		return strings.Compare(a, b)
+	}
+
+	pa, pb := strings.Split(va, "."), strings.Split(vb, ".")
+	for i := 0; i < len(pa) && i < len(pb); i++ {
+		na, _ := strconv.Atoi(pa[i])
+		nb, _ := strconv.Atoi(pb[i])
+		switch {
+		case na < nb:
+			return -1
+		case na > nb:
+			return 1
+		}
+	}
+	switch {
+	case len(pa) < len(pb):
+		return -1
+	case len(pa) > len(pb):
+		return 1
+	}
+	return 0
+}
+
+// controlPlaneOrder denies a control plane Node the reboot lock until at least
+// one of the group's workers has updated to an OS image newer than the Node's
+// own, no worker is behind the newest OS image of the group, and no worker
+// holds a reboot slot. Other control plane Nodes must not be rebooting (holding
+// a reboot slot) or NotReady, so etcd keeps quorum. Holders should list the
+// holders of every group.
+func (s *Server) controlPlaneOrder(ctx context.Context, config *GroupConfig, node *v1.Node, holders []Holder) error {
+	if node == nil || !isControlPlane(node) {
+		return nil
+	}
+
+	nodes, err := s.listNodes(ctx, "")
+	if err != nil {
+		return err
+	}
+	selector, err := labels.Parse(config.NodeSelector)
+	if err != nil {
+		return err
+	}
+
+	held := map[string]bool{}
+	for _, holder := range holders {
+		held[holder.ID] = true
+	}
+
+	// other control plane Nodes must be Ready and not rebooting
+	for _, other := range nodes {
+		if other.GetName() == node.GetName() || !isControlPlane(&other) {
+			continue
+		}
+		if !isNodeReady(&other) {
+			return deny(KindLockHeld, "reboot lease lock unavailable, control plane node %s is NotReady, waiting to keep etcd quorum", other.GetName())
+		}
+		if s.holds(&other, held) {
+			return deny(KindLockHeld, "reboot lease lock unavailable, control plane node %s is rebooting, waiting to keep etcd quorum", other.GetName())
+		}
+	}
+
+	// group workers must have rebooted into the newest OS image. A Node that
+	// requests the lock has an update pending, so until a worker runs an image
+	// newer than the Node's own, the workers have not updated this cycle
+	own := node.Status.NodeInfo.OSImage
+	target := own
+	workers := []v1.Node{}
+	for _, other := range nodes {
+		if !selector.Matches(labels.Set(other.GetLabels())) {
+			continue
+		}
+		if compareOSImages(other.Status.NodeInfo.OSImage, target) > 0 {
+			target = other.Status.NodeInfo.OSImage
+		}
+		if !isControlPlane(&other) {
+			workers = append(workers, other)
+		}
+	}
+	if len(workers) == 0 {
+		return nil
+	}
+	if target == own {
+		return deny(KindLockHeld, "reboot lease lock unavailable, control plane nodes reboot last, waiting for workers to update first")
+	}
+
+	pending := []string{}
+	for _, worker := range workers {
+		if compareOSImages(worker.Status.NodeInfo.OSImage, target) < 0 || s.holds(&worker, held) {
+			pending = append(pending, worker.GetName())
+		}
+	}
+	if len(pending) > 0 {
+		return deny(KindLockHeld, "reboot lease lock unavailable, control plane nodes reboot last, waiting for workers to update to %s: %s", target, strings.Join(pending, ", "))
+	}
+	return nil
+}
+
+// holds returns true if any of a Node's Zincati IDs holds a reboot slot.
+func (s *Server) holds(node *v1.Node, held map[string]bool) bool {
+	for _, strategy := range s.matchers {
+		if id, ok := nodeZincatiID(node, strategy, ZincatiID); ok && held[id] {
+			return true
+		}
+	}
+	return false
+}
+
+// acquireControlPlane obtains the control plane lock group's single hold for a
+// control plane Node, so only one reboots at a time across groups. Orphaned
+// holds are released first. Returns whether the hold was newly acquired.
+func (s *Server) acquireControlPlane(ctx context.Context, holder Holder) (bool, error) {
+	s.releaseOrphaned(ctx)
+
+	_, acquired, err := s.store.Acquire(ctx, controlPlaneGroup, holder, func(lock *RebootLock) error {
+		if len(lock.Holders) == 0 {
+			return nil
+		}
+		name := lock.Holders[0].Node
+		if name == "" {
+			name = lock.Holders[0].ID
+		}
+		return deny(KindLockHeld, "reboot lease lock unavailable, control plane node %s is rebooting, waiting to keep etcd quorum", name)
+	})
+	return acquired, err
+}
+
+// releaseControlPlane releases the control plane hold of an id (if any).
+// Errors are logged, since orphaned holds are released later.
+func (s *Server) releaseControlPlane(ctx context.Context, id string) {
+	_, err := s.store.Release(ctx, controlPlaneGroup, id, nil)
+	if err != nil {
+		s.log.WithField("id", id).Errorf("fleetlock: error releasing control plane hold: %v", err)
+	}
+}
+
+// releaseOrphaned releases control plane holds older than orphanedHoldAge
+// whose holder holds no reboot slot in any group. Errors are logged, since a
+// hold that can't be checked is kept.
+func (s *Server) releaseOrphaned(ctx context.Context) {
+	lock, err := s.store.Get(ctx, controlPlaneGroup)
+	if err != nil {
+		s.log.Errorf("fleetlock: error getting control plane holds: %v", err)
+		return
+	}
+	expired := lock.Expired(orphanedHoldAge, time.Now())
+	if len(expired) == 0 {
+		return
+	}
+
+	others, err := s.otherHolders(ctx, controlPlaneGroup)
+	if err != nil {
+		s.log.Errorf("fleetlock: error checking control plane holds: %v", err)
+		return
+	}
+	held := map[string]bool{}
+	for _, holder := range others {
+		held[holder.ID] = true
+	}
+
+	for _, holder := range expired {
+		if held[holder.ID] {
+			continue
+		}
+
+		fields := logrus.Fields{
+			"id":   holder.ID,
+			"node": holder.Node,
+		}
+		// release only the orphaned hold, not a hold re-acquired since
+		_, err := s.store.Release(ctx, controlPlaneGroup, holder.ID, unchangedHold(holder))
+		if errors.Is(err, errHoldChanged) {
+			continue
+		}
+		if err != nil {
+			s.log.WithFields(fields).Errorf("fleetlock: error releasing orphaned control plane hold: %v", err)
+			return
+		}
+		s.log.WithFields(fields).Info("fleetlock: released orphaned control plane hold")
+	}
+}
+
+// otherHolders returns the holders of every group's reboot lock, except the
+// given group.
+func (s *Server) otherHolders(ctx context.Context, except string) ([]Holder, error) {
+	locks, err := s.store.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("fleetlock: error listing reboot locks: %v", err)
+	}
+
+	holders := []Holder{}
+	for group, lock := range locks {
+		if group != except {
+			holders = append(holders, lock.Holders...)
+		}
+	}
+	return holders, nil
+}
@@ -0,0 +1,126 @@
+package fleetlock
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestIsControlPlane(t *testing.T) {
+	cases := []struct {
+		labels   map[string]string
+		taints   []v1.Taint
+		expected bool
+	}{
+		{nil, nil, false},
+		{map[string]string{"node-role.kubernetes.io/control-plane": ""}, nil, true},
+		{map[string]string{"node.kubernetes.io/controller": "true"}, nil, true},
+		{map[string]string{"node.kubernetes.io/controller": "false"}, nil, false},
+		{map[string]string{"node.kubernetes.io/worker": ""}, nil, false},
+		{nil, []v1.Taint{{Key: "node-role.kubernetes.io/controller", Effect: v1.TaintEffectNoSchedule}}, true},
+		{nil, []v1.Taint{{Key: "other", Effect: v1.TaintEffectNoSchedule}}, false},
+	}
+
+	for _, c := range cases {
+		node := testNode(0)
+		node.Labels = c.labels
+		node.Spec.Taints = c.taints
+		assert.Equal(t, c.expected, isControlPlane(&node))
+	}
+}
+
+func TestCompareOSImages(t *testing.T) {
+	cases := []struct {
+		a, b     string
+		expected int
+	}{
+		{"Fedora CoreOS 40.20240416.3.1", "Fedora CoreOS 40.20240416.3.1", 0},
+		{"Fedora CoreOS 40.20240416.3.1", "Fedora CoreOS 40.20240504.3.0", -1},
+		{"Fedora CoreOS 41.20241027.3.0", "Fedora CoreOS 40.20241019.3.0", 1},
+		{"Flatcar Container Linux by Kinvolk 3815.2.0 (Oklo)", "Flatcar Container Linux by Kinvolk 3815.2.10 (Oklo)", -1},
+		{"Fedora CoreOS 40.20240416.3", "Fedora CoreOS 40.20240416.3.1", -1},
+		{"b", "a", 1},
+	}
+
+	for _, c := range cases {
+		assert.Equal(t, c.expected, compareOSImages(c.a, c.b), "%s vs %s", c.a, c.b)
+	}
+}
+
+func TestControlPlaneOrder(t *testing.T) {
+	const (
+		oldImage = "Fedora CoreOS 40.20240416.3.1"
+		newImage = "Fedora CoreOS 40.20240504.3.0"
+	)
+	controller := func(i int) v1.Node {
+		node := testNode(i)
+		node.Labels = map[string]string{"node.kubernetes.io/controller": "true"}
+		node.Status.NodeInfo.OSImage = oldImage
+		return node
+	}
+	worker := func(i int, image string) v1.Node {
+		node := testNode(i)
+		node.Labels = map[string]string{"node.kubernetes.io/worker": ""}
+		node.Status.NodeInfo.OSImage = image
+		return node
+	}
+	notReady := controller(1)
+	notReady.Status.Conditions[0].Status = v1.ConditionFalse
+	holder1, _ := ZincatiID(testNode(1).Status.NodeInfo.MachineID)
+	holder2, _ := ZincatiID(testNode(2).Status.NodeInfo.MachineID)
+	holder3, _ := ZincatiID(testNode(3).Status.NodeInfo.MachineID)
+
+	cases := []struct {
+		nodes   []v1.Node
+		holders []Holder
+		denied  bool
+	}{
+		// workers updated, other controllers Ready
+		{[]v1.Node{controller(1), worker(2, newImage), worker(3, newImage)}, nil, false},
+		// no workers
+		{[]v1.Node{controller(1)}, nil, false},
+		// controller polls first, before any worker updated
+		{[]v1.Node{controller(1), worker(2, oldImage), worker(3, oldImage)}, nil, true},
+		// no worker updated yet, a worker holds its reboot slot
+		{[]v1.Node{controller(1), worker(2, oldImage), worker(3, oldImage)}, []Holder{{ID: holder2}}, true},
+		// a worker hasn't updated
+		{[]v1.Node{controller(1), worker(2, newImage), worker(3, oldImage)}, nil, true},
+		// a worker updated, but still holds its reboot slot
+		{[]v1.Node{controller(1), worker(2, newImage), worker(3, newImage)}, []Holder{{ID: holder3}}, true},
+		// another controller is NotReady
+		{[]v1.Node{notReady, worker(2, newImage)}, nil, true},
+		// another controller is rebooting
+		{[]v1.Node{controller(1), worker(2, newImage)}, []Holder{{ID: holder1}}, true},
+	}
+
+	for _, c := range cases {
+		node := controller(0)
+		objs := []v1.Node{node}
+		objs = append(objs, c.nodes...)
+		client := fake.NewClientset()
+		for i := range objs {
+			client.Tracker().Add(&objs[i])
+		}
+		s := &Server{
+			kubeClient: client,
+			matchers:   DefaultMatchers,
+		}
+
+		err := s.controlPlaneOrder(context.Background(), &GroupConfig{}, &node, c.holders)
+		var denied *denial
+		if c.denied {
+			assert.True(t, errors.As(err, &denied), "expected denial")
+		} else {
+			assert.Nil(t, err)
+		}
+	}
+
+	// workers are not ordered
+	s := &Server{kubeClient: fake.NewClientset(), matchers: DefaultMatchers}
+	node := worker(0, oldImage)
+	assert.Nil(t, s.controlPlaneOrder(context.Background(), &GroupConfig{}, &node, nil))
+}
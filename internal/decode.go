@@ -30,5 +30,9 @@ func decodeMessage(req *http.Request) (*Message, error) {
 		return nil, fmt.Errorf("message missing group: %v", msg)
 	}
 
+	if msg.ClientParmas.Group == controlPlaneGroup {
+		return nil, fmt.Errorf("message group %s is reserved: %v", controlPlaneGroup, msg)
+	}
+
 	return msg, nil
 }
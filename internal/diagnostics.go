@@ -0,0 +1,200 @@
+package fleetlock
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"k8s.io/api/core/v1"
+)
+
+// maxUnmatchedIDs bounds the number of unmatched Zincati IDs remembered by a
+// requestLog.
+const maxUnmatchedIDs = 1000
+
+// unmatchedWindow is how long Zincati IDs matching no Node are remembered.
+const unmatchedWindow = 24 * time.Hour
+
+// requestLog remembers the Kubernetes Nodes matched by lock requests and
+// recent Zincati IDs that matched no Node. It isn't persisted across restarts.
+type requestLog struct {
+	mu sync.Mutex
+	// last request time by Node name
+	seen      map[string]time.Time
+	unmatched map[string]time.Time
+}
+
+// newRequestLog returns an empty requestLog.
+func newRequestLog() *requestLog {
+	return &requestLog{
+		seen:      map[string]time.Time{},
+		unmatched: map[string]time.Time{},
+	}
+}
+
+// See records a Node matched by a lock request.
+func (l *requestLog) See(node string, now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.seen[node] = now
+}
+
+// Retain forgets seen Nodes other than the given Node names (e.g. deleted
+// Nodes).
+func (l *requestLog) Retain(nodes []string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	keep := make(map[string]bool, len(nodes))
+	for _, node := range nodes {
+		keep[node] = true
+	}
+	for node := range l.seen {
+		if !keep[node] {
+			delete(l.seen, node)
+		}
+	}
+}
+
+// Unmatched records a Zincati ID that matched no Kubernetes Node.
+func (l *requestLog) Unmatched(id string, now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	touchID(l.unmatched, id, now)
+}
+
+// LastSeen returns the time a lock request last matched a Node.
+func (l *requestLog) LastSeen(node string) (time.Time, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	t, ok := l.seen[node]
+	return t, ok
+}
+
+// RecentUnmatched returns Zincati IDs that matched no Node within the window,
+// most recent first.
+func (l *requestLog) RecentUnmatched(now time.Time) []UnmatchedID {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	ids := []UnmatchedID{}
+	for id, t := range l.unmatched {
+		if now.Sub(t) > unmatchedWindow {
+			delete(l.unmatched, id)
+			continue
+		}
+		ids = append(ids, UnmatchedID{ID: id, LastSeen: t})
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i].LastSeen.After(ids[j].LastSeen)
+	})
+	return ids
+}
+
+// touchID sets the time an ID was seen, evicting the least recent ID when full.
+func touchID(ids map[string]time.Time, id string, now time.Time) {
+	if _, ok := ids[id]; !ok && len(ids) >= maxUnmatchedIDs {
+		var oldest string
+		for other, t := range ids {
+			if oldest == "" || t.Before(ids[oldest]) {
+				oldest = other
+			}
+		}
+		delete(ids, oldest)
+	}
+	ids[id] = now
+}
+
+// Diagnostics describes how Zincati requests match Kubernetes Nodes.
+type Diagnostics struct {
+	Nodes     []NodeDiagnostics `json:"nodes"`
+	Unmatched []UnmatchedID     `json:"unmatched"`
+}
+
+// NodeDiagnostics describes a Kubernetes Node's IDs.
+type NodeDiagnostics struct {
+	Name       string `json:"name"`
+	MachineID  string `json:"machineID"`
+	SystemUUID string `json:"systemUUID"`
+	// Zincati IDs by matching strategy
+	ZincatiIDs map[string]string `json:"zincatiIDs"`
+	// whether a lock request has matched the Node since starting
+	Seen     bool       `json:"seen"`
+	LastSeen *time.Time `json:"lastSeen,omitempty"`
+}
+
+// UnmatchedID is a Zincati ID in a lock request that matched no Node.
+type UnmatchedID struct {
+	ID       string    `json:"id"`
+	LastSeen time.Time `json:"lastSeen"`
+}
+
+// diagnostics lists the IDs of each Kubernetes Node and recent Zincati IDs
+// that matched no Node.
+func (s *Server) diagnostics(ctx context.Context) (*Diagnostics, error) {
+	nodes, err := s.listNodes(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].GetName() < nodes[j].GetName()
+	})
+
+	diag := &Diagnostics{
+		Nodes:     make([]NodeDiagnostics, 0, len(nodes)),
+		Unmatched: s.requests.RecentUnmatched(time.Now()),
+	}
+	names := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		diag.Nodes = append(diag.Nodes, s.nodeDiagnostics(&node))
+		names = append(names, node.GetName())
+	}
+	s.requests.Retain(names)
+	return diag, nil
+}
+
+// nodeDiagnostics describes a Node's IDs under each configured matching
+// strategy and when a lock request last matched them.
+func (s *Server) nodeDiagnostics(node *v1.Node) NodeDiagnostics {
+	diag := NodeDiagnostics{
+		Name:       node.GetName(),
+		MachineID:  node.Status.NodeInfo.MachineID,
+		SystemUUID: node.Status.NodeInfo.SystemUUID,
+		ZincatiIDs: map[string]string{},
+	}
+	for _, strategy := range s.matchers {
+		if id, ok := nodeZincatiID(node, strategy, ZincatiID); ok {
+			diag.ZincatiIDs[strategy] = id
+		}
+	}
+	if t, ok := s.requests.LastSeen(node.GetName()); ok {
+		diag.Seen = true
+		diag.LastSeen = &t
+	}
+	return diag
+}
+
+// diagnosticsHandler serves Node matching diagnostics as JSON.
+func (s *Server) diagnosticsHandler() http.Handler {
+	fn := func(w http.ResponseWriter, req *http.Request) {
+		if s.kubeClient == nil {
+			http.Error(w, "diagnostics require a Kubernetes client", http.StatusNotFound)
+			return
+		}
+
+		diag, err := s.diagnostics(req.Context())
+		if err != nil {
+			s.log.Errorf("fleetlock: error listing node diagnostics: %v", err)
+			http.Error(w, "error listing nodes", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		json.NewEncoder(w).Encode(diag)
+	}
+	return http.HandlerFunc(fn)
+}
@@ -0,0 +1,115 @@
+package fleetlock
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestRequestLog(t *testing.T) {
+	now := time.Now()
+	l := newRequestLog()
+	l.See("node-0", now)
+	l.Unmatched("x", now.Add(-2*unmatchedWindow))
+	l.Unmatched("y", now.Add(-time.Minute))
+	l.Unmatched("z", now)
+
+	seen, ok := l.LastSeen("node-0")
+	assert.True(t, ok)
+	assert.Equal(t, now, seen)
+	_, ok = l.LastSeen("node-1")
+	assert.False(t, ok)
+
+	// expired IDs are dropped, most recent first
+	expected := []UnmatchedID{
+		{ID: "z", LastSeen: now},
+		{ID: "y", LastSeen: now.Add(-time.Minute)},
+	}
+	assert.Equal(t, expected, l.RecentUnmatched(now))
+
+	// seen Nodes aren't evicted, however many there are
+	for i := 1; i <= 2*maxUnmatchedIDs; i++ {
+		l.See(fmt.Sprintf("node-%d", i), now.Add(time.Duration(i)*time.Second))
+	}
+	_, ok = l.LastSeen("node-0")
+	assert.True(t, ok)
+
+	// until they're deleted
+	l.Retain([]string{"node-1"})
+	assert.Len(t, l.seen, 1)
+	_, ok = l.LastSeen("node-0")
+	assert.False(t, ok)
+
+	// least recently unmatched IDs are evicted when full
+	for i := 0; i < maxUnmatchedIDs; i++ {
+		l.Unmatched(fmt.Sprintf("id-%d", i), now.Add(time.Duration(i+1)*time.Second))
+	}
+	assert.Len(t, l.unmatched, maxUnmatchedIDs)
+	assert.NotContains(t, l.unmatched, "z")
+}
+
+func TestDiagnosticsHandler(t *testing.T) {
+	// node-0 has been seen, node-1 has not
+	node0, node1 := testNode(0), testNode(1)
+	node1.Status.NodeInfo.SystemUUID = "00000000-0000-0000-0000-00000000000b"
+	id0, _ := ZincatiID(node0.Status.NodeInfo.MachineID)
+	id1, _ := ZincatiID(node1.Status.NodeInfo.MachineID)
+	uuid1, _ := ZincatiID(node1.Status.NodeInfo.SystemUUID)
+
+	now := time.Now().UTC().Truncate(time.Second)
+	s := &Server{
+		log:        logrus.New(),
+		kubeClient: fake.NewClientset(&node1, &node0),
+		matchers:   DefaultMatchers,
+		requests:   newRequestLog(),
+	}
+	s.requests.See("node-0", now)
+	s.requests.See("node-2", now)
+	s.requests.Unmatched("unknown", now)
+
+	w := httptest.NewRecorder()
+	GETHandler(s.diagnosticsHandler()).ServeHTTP(w, httptest.NewRequest("GET", "/-/nodes", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+	diag := &Diagnostics{}
+	require.Nil(t, json.NewDecoder(w.Body).Decode(diag))
+	expected := &Diagnostics{
+		Nodes: []NodeDiagnostics{
+			{
+				Name:       "node-0",
+				MachineID:  node0.Status.NodeInfo.MachineID,
+				ZincatiIDs: map[string]string{MatchMachineID: id0},
+				Seen:       true,
+				LastSeen:   &now,
+			},
+			{
+				Name:       "node-1",
+				MachineID:  node1.Status.NodeInfo.MachineID,
+				SystemUUID: node1.Status.NodeInfo.SystemUUID,
+				ZincatiIDs: map[string]string{MatchMachineID: id1, MatchSystemUUID: uuid1},
+			},
+		},
+		Unmatched: []UnmatchedID{
+			{ID: "unknown", LastSeen: now},
+		},
+	}
+	assert.Equal(t, expected, diag)
+
+	// deleted Nodes are forgotten
+	_, ok := s.requests.LastSeen("node-2")
+	assert.False(t, ok)
+
+	// diagnostics are read-only
+	w = httptest.NewRecorder()
+	GETHandler(s.diagnosticsHandler()).ServeHTTP(w, httptest.NewRequest("POST", "/-/nodes", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+}
@@ -2,47 +2,120 @@ package fleetlock
 
 import (
 	"context"
-	"fmt"
+	"errors"
+	"strings"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	"k8s.io/api/core/v1"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	"github.com/poseidon/fleetlock/internal/drainer"
 )
 
+// errNodeNotMatched indicates a Zincati ID matches no Kubernetes Node.
+var errNodeNotMatched = errors.New("fleetlock: Zincati request matches no Kubernetes Nodes")
+
 // DrainNode matches a Zincati request to a node, cordons the node, and evicts
 // its pods.
-func (s *Server) DrainNode(ctx context.Context, id string) error {
+func (s *Server) DrainNode(ctx context.Context, group, id string, config *DrainConfig) error {
+	// draining requires a Kubernetes client
+	if s.kubeClient == nil {
+		return nil
+	}
+
 	// match Zincati ID to Kubernetes Node
 	node, err := s.matchNode(ctx, id)
 	if err != nil {
 		return err
 	}
 
-	drainer := drain.New(&drain.Config{
-		Client: s.kubeClient,
-		Logger: s.log,
-	})
-	return drainer.Drain(ctx, node.GetName())
+	drainer, err := s.newDrainer(group, config)
+	if err != nil {
+		return err
+	}
+	s.nodeEvent(group, node.GetName(), v1.EventTypeNormal, reasonDrainStarted, "Draining node for reboot")
+	report, err := drainer.Drain(ctx, node.GetName())
+
+	fields := logrus.Fields{
+		"id":      id,
+		"node":    node.GetName(),
+		"evicted": len(report.Evicted),
+		"skipped": len(report.Skipped),
+		"failed":  len(report.Failed),
+		"forced":  len(report.ForceDeleted),
+	}
+	for _, result := range report.Failed {
+		s.log.WithFields(fields).WithField("pod", result.Pod).Warnf("fleetlock: pod not evicted: %s", result.Reason)
+		s.nodeEvent(group, node.GetName(), v1.EventTypeWarning, reasonEvictionFailed, "Pod %s not evicted: %s", result.Pod, result.Reason)
+	}
+	s.metrics.podForceDeletes.WithLabelValues(group).Add(float64(len(report.ForceDeleted)))
+	s.log.WithFields(fields).Info("fleetlock: drain report")
+	if err != nil {
+		s.nodeEvent(group, node.GetName(), v1.EventTypeWarning, reasonDrainFailed, "Drain failed (%s): %v", report, err)
+		return err
+	}
+	s.nodeEvent(group, node.GetName(), v1.EventTypeNormal, reasonDrained, "Drained node (%s)", report)
+
+	// wait for CSI volumes to detach, so rescheduled Pods can attach them
+	if timeout := config.VolumeDetachTimeout.Duration; timeout > 0 {
+		s.log.WithFields(fields).Info("fleetlock: waiting for volumes to detach")
+		attached, err := s.waitForVolumeDetach(ctx, node.GetName(), timeout, volumePollInterval)
+		if err != nil {
+			return err
+		}
+		if len(attached) > 0 {
+			s.log.WithFields(fields).Warnf("fleetlock: volumes still attached after %s: %s", timeout, strings.Join(attached, ", "))
+		}
+	}
+	return nil
 }
 
 // UncordonNode uncordons a Kubernetes Node that matches the Zincati request ID.
-func (s *Server) UncordonNode(ctx context.Context, id string) error {
+// Nodes fleetlock didn't cordon are left unschedulable.
+func (s *Server) UncordonNode(ctx context.Context, group, id string, config *DrainConfig) error {
+	// uncordoning requires a Kubernetes client
+	if s.kubeClient == nil {
+		return nil
+	}
+
 	// match Zincati ID to Kubernetes Node
 	node, err := s.matchNode(ctx, id)
 	if err != nil {
 		return err
 	}
 
-	drainer := drain.New(&drain.Config{
-		Client: s.kubeClient,
-		Logger: s.log,
-	})
+	drainer, err := s.newDrainer(group, config)
+	if err != nil {
+		return err
+	}
 	return drainer.Uncordon(ctx, node.GetName())
 }
 
-// MatchNode matches a Zincati request ID to a Kubernetes Node.
+// newDrainer returns a Drainer configured by a group's drain settings.
+func (s *Server) newDrainer(group string, config *DrainConfig) (drain.Drainer, error) {
+	filter, err := config.Filter()
+	if err != nil {
+		return nil, err
+	}
+
+	taint := config.CordonTaint()
+	return drain.New(&drain.Config{
+		Client:           s.kubeClient,
+		Logger:           s.log,
+		Group:            group,
+		WaitTimeout:      config.WaitTimeout(),
+		Workers:          config.Workers,
+		Filter:           filter,
+		JobTimeout:       config.JobTimeout.Duration,
+		ForceDeleteAfter: config.ForceDeleteAfter.Duration,
+		Recorder:         s.recorder,
+		Taint:            taint,
+		TaintOnly:        config.Cordon == CordonTaint,
+	}), nil
+}
+
+// MatchNode matches a Zincati request ID to a Kubernetes Node, trying each
+// configured matching strategy in order, via the Node cache once synced.
 // See ZincatiID for how Zincati and systemd compute IDs.
 func (s *Server) matchNode(ctx context.Context, id string) (*v1.Node, error) {
 	fields := logrus.Fields{
@@ -50,23 +123,53 @@ func (s *Server) matchNode(ctx context.Context, id string) (*v1.Node, error) {
 	}
 	s.log.WithFields(fields).Info("fleetlock: match Zincati request to Kubernetes node")
 
-	nodes, err := s.kubeClient.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	node, strategy, err := s.findNode(ctx, id)
 	if err != nil {
 		s.log.WithFields(fields).Infof("fleetlock: nodes list error: %v", err)
 		return nil, err
 	}
+	if node == nil {
+		s.metrics.nodeMatches.WithLabelValues("none").Inc()
+		s.requests.Unmatched(id, time.Now())
+		s.log.WithFields(fields).Info("fleetlock: Zincati request matches no Kubernetes Nodes")
+		return nil, errNodeNotMatched
+	}
+
+	s.metrics.nodeMatches.WithLabelValues(strategy).Inc()
+	fields["node"] = node.GetName()
+	fields["strategy"] = strategy
+	fields["machineID"] = node.Status.NodeInfo.MachineID
+	fields["systemUUID"] = node.Status.NodeInfo.SystemUUID
+	s.log.WithFields(fields).Info("fleetlock: Zincati request matches Kubernetes node")
+	return node, nil
+}
 
-	for _, node := range nodes.Items {
-		zincatiID, err := ZincatiID(node.Status.NodeInfo.MachineID)
-		if err == nil && id == zincatiID {
-			fields["node"] = node.GetName()
-			fields["machineID"] = node.Status.NodeInfo.MachineID
-			fields["systemUUID"] = node.Status.NodeInfo.SystemUUID
-			s.log.WithFields(fields).Info("fleetlock: Zincati request matches Kubernetes node")
-			return &node, nil
+// findNode returns the Kubernetes Node with the given Zincati ID (or nil) and
+// the matching strategy that found it.
+func (s *Server) findNode(ctx context.Context, id string) (*v1.Node, string, error) {
+	if s.nodes != nil && s.nodes.Synced() {
+		for _, strategy := range s.matchers {
+			nodes, err := s.nodes.ByZincatiID(strategy, id)
+			if err != nil {
+				return nil, "", err
+			}
+			if len(nodes) > 0 {
+				return nodes[0].DeepCopy(), strategy, nil
+			}
 		}
+		return nil, "", nil
 	}
 
-	s.log.WithFields(fields).Info("fleetlock: Zincati request matches no Kubernetes Nodes")
-	return nil, fmt.Errorf("fleetlock: Zincati request matches no Kubernetes Nodes")
+	nodes, err := s.listNodes(ctx, "")
+	if err != nil {
+		return nil, "", err
+	}
+	for _, strategy := range s.matchers {
+		for _, node := range nodes {
+			if zincatiID, ok := nodeZincatiID(&node, strategy, ZincatiID); ok && id == zincatiID {
+				return &node, strategy, nil
+			}
+		}
+	}
+	return nil, "", nil
 }
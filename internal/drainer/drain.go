@@ -2,27 +2,112 @@ package drain
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/sirupsen/logrus"
 	"k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
 	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/retry"
 )
 
+const (
+	// initial and maximum backoff between refused eviction retries
+	evictionBackoff    = 1 * time.Second
+	maxEvictionBackoff = 30 * time.Second
+	// default maximum concurrent evictions
+	defaultWorkers = 10
+	// default bound on retrying refused evictions without a wait timeout
+	defaultRetryTimeout = 1 * time.Minute
+)
+
+// EvictAnnotation is a Pod annotation which opts a Pod out of eviction when
+// set to "false".
+const EvictAnnotation = "fleetlock.poseidon/evict"
+
+// CordonAnnotation is a Node annotation recording that the drainer cordoned
+// the Node, so only those Nodes are uncordoned. Its value is a CordonMarker.
+const CordonAnnotation = "fleetlock.poseidon/cordoned"
+
+// CordonMarker records the reboot group and time a Node was cordoned.
+type CordonMarker struct {
+	Group string    `json:"group"`
+	Time  time.Time `json:"time"`
+}
+
+// ErrTimeout indicates a drain did not complete within the wait timeout.
+var ErrTimeout = errors.New("drainer: timeout draining node")
+
+// ErrRefused indicates a drain was refused because of Pods the Filter does not
+// allow to be evicted.
+var ErrRefused = errors.New("drainer: refusing to drain node")
+
 // Config configures a Drainer.
 type Config struct {
 	Client kubernetes.Interface
 	Logger *logrus.Logger
+	// reboot group recorded when cordoning
+	Group string
+	// wait up to the timeout for evicted Pods to be deleted (optional)
+	WaitTimeout time.Duration
+	// without a wait timeout, retry refused evictions up to the timeout
+	// (default 1m)
+	RetryTimeout time.Duration
+	// interval between checks for deleted Pods (default 5s)
+	PollInterval time.Duration
+	// maximum concurrent Pod evictions (default 10)
+	Workers int
+	// which Pods to evict (optional)
+	Filter Filter
+	// wait up to the timeout for Job Pods to complete before evicting them
+	// (optional)
+	JobTimeout time.Duration
+	// force delete Pods still terminating this long past their grace period,
+	// while waiting for deletion (optional)
+	ForceDeleteAfter time.Duration
+	// records Events about Pods (optional)
+	Recorder record.EventRecorder
+	// taint to add when cordoning and remove when uncordoning (optional)
+	Taint *v1.Taint
+	// cordon with the taint only, leaving the Node schedulable
+	TaintOnly bool
+}
+
+// Filter configures which of a node's Pods are evicted, similar to kubectl
+// drain options. Mirror and DaemonSet Pods are always skipped.
+type Filter struct {
+	// refuse to drain nodes with Pods using emptyDir volumes
+	RefuseLocalStorage bool
+	// refuse to drain nodes with Pods without a controller
+	RefuseUnmanaged bool
+	// delete, rather than evict, Pods without a controller
+	DeleteUnmanaged bool
+	// skip Pods matching the selector (optional)
+	SkipSelector labels.Selector
+	// skip Pods in the given namespaces
+	ExcludeNamespaces []string
 }
 
 // Drainer manages cordoning nodes and evicting Pods.
 type Drainer interface {
-	// Drain cordons a node and evicts its Pods.
-	Drain(ctx context.Context, node string) error
+	// Drain cordons a node and evicts its Pods. Returns a Report of each Pod,
+	// even if draining failed.
+	Drain(ctx context.Context, node string) (*Report, error)
 	// Cordon marks a Kubernetes Node as unschedulable.
 	Cordon(ctx context.Context, node string) error
 	// Uncordon marks a Kubernetes Node as schedulable.
@@ -31,67 +116,565 @@ type Drainer interface {
 
 // New returns a new Drainer.
 func New(config *Config) Drainer {
+	pollInterval := config.PollInterval
+	if pollInterval == 0 {
+		pollInterval = 5 * time.Second
+	}
+	workers := config.Workers
+	if workers <= 0 {
+		workers = defaultWorkers
+	}
+	retryTimeout := config.RetryTimeout
+	if retryTimeout <= 0 {
+		retryTimeout = defaultRetryTimeout
+	}
+
 	return &drainer{
-		client: config.Client,
-		log:    config.Logger,
+		client:       config.Client,
+		log:          config.Logger,
+		group:        config.Group,
+		waitTimeout:  config.WaitTimeout,
+		retryTimeout: retryTimeout,
+		pollInterval: pollInterval,
+		workers:      workers,
+		filter:       config.Filter,
+		jobTimeout:   config.JobTimeout,
+		forceAfter:   config.ForceDeleteAfter,
+		recorder:     config.Recorder,
+		taint:        config.Taint,
+		taintOnly:    config.TaintOnly && config.Taint != nil,
 	}
 }
 
 // drain is a Kubernetes node cordon and drainer.
 type drainer struct {
-	client kubernetes.Interface
-	log    *logrus.Logger
+	client       kubernetes.Interface
+	log          *logrus.Logger
+	group        string
+	waitTimeout  time.Duration
+	retryTimeout time.Duration
+	pollInterval time.Duration
+	workers      int
+	filter       Filter
+	jobTimeout   time.Duration
+	forceAfter   time.Duration
+	recorder     record.EventRecorder
+	taint        *v1.Taint
+	taintOnly    bool
+
+	// discovered Eviction API version
+	mu       sync.Mutex
+	eviction *schema.GroupVersion
 }
 
-// Cordon marks a Kubernetes Node as unschedulable.
+// Cordon marks a Kubernetes Node as unschedulable and/or adds the taint.
+// Nodes already unschedulable are left for their owner to uncordon.
 func (d *drainer) Cordon(ctx context.Context, node string) error {
 	d.log.WithField("node", node).Info("drainer: cordoning node")
-	return d.setUnschedulable(ctx, node, true)
+	return d.updateNode(ctx, node, func(n *v1.Node) (bool, error) {
+		changed := false
+		if !d.taintOnly {
+			marked, err := d.markCordoned(n)
+			if err != nil {
+				return false, err
+			}
+			changed = marked
+		}
+		if d.taint != nil && !hasTaint(n.Spec.Taints, d.taint) {
+			taints, _ := removeTaint(n.Spec.Taints, d.taint)
+			n.Spec.Taints = append(taints, *d.taint)
+			changed = true
+		}
+		return changed, nil
+	})
 }
 
-// Uncordon marks a Kubernetes Node as schedulable.
+// Uncordon marks a Kubernetes Node as schedulable and/or removes the taint.
+// Nodes the drainer didn't cordon are left unschedulable.
 func (d *drainer) Uncordon(ctx context.Context, node string) error {
 	d.log.WithField("node", node).Info("drainer: uncordoning node")
-	return d.setUnschedulable(ctx, node, false)
+	return d.updateNode(ctx, node, func(n *v1.Node) (bool, error) {
+		changed := false
+		if !d.taintOnly {
+			changed = d.unmarkCordoned(n)
+		}
+		if d.taint != nil {
+			taints, removed := removeTaint(n.Spec.Taints, d.taint)
+			n.Spec.Taints = taints
+			changed = changed || removed
+		}
+		return changed, nil
+	})
+}
+
+// markCordoned marks a Node unschedulable and annotates it with a
+// CordonMarker, unless the Node was already unschedulable. Returns whether
+// the Node changed.
+func (d *drainer) markCordoned(node *v1.Node) (bool, error) {
+	if _, ok := node.Annotations[CordonAnnotation]; ok {
+		changed := !node.Spec.Unschedulable
+		node.Spec.Unschedulable = true
+		return changed, nil
+	}
+	if node.Spec.Unschedulable {
+		d.log.WithField("node", node.GetName()).Info("drainer: node already cordoned, leaving it to its owner")
+		return false, nil
+	}
+
+	marker, err := json.Marshal(&CordonMarker{
+		Group: d.group,
+		Time:  time.Now().UTC(),
+	})
+	if err != nil {
+		return false, err
+	}
+	if node.Annotations == nil {
+		node.Annotations = map[string]string{}
+	}
+	node.Annotations[CordonAnnotation] = string(marker)
+	node.Spec.Unschedulable = true
+	return true, nil
+}
+
+// unmarkCordoned marks a Node schedulable and removes its CordonMarker, if
+// present. Returns whether the Node changed.
+func (d *drainer) unmarkCordoned(node *v1.Node) bool {
+	if _, ok := node.Annotations[CordonAnnotation]; !ok {
+		if node.Spec.Unschedulable {
+			d.log.WithField("node", node.GetName()).Warn("drainer: node not cordoned by fleetlock, skip uncordon")
+		}
+		return false
+	}
+	delete(node.Annotations, CordonAnnotation)
+	node.Spec.Unschedulable = false
+	return true
 }
 
 // Drain drains a Kubernetes Node.
-func (d *drainer) Drain(ctx context.Context, node string) error {
+func (d *drainer) Drain(ctx context.Context, node string) (*Report, error) {
 	fields := logrus.Fields{
 		"node": node,
 	}
+	report := newReport()
+
+	// bound evictions and waiting by the wait timeout
+	if d.waitTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.waitTimeout)
+		defer cancel()
+	}
+
+	// refused drains leave the Node schedulable
+	pods, err := d.getPodsForDeletion(ctx, node, report)
+	if err != nil {
+		d.log.WithFields(fields).Errorf("drainer: error getting pods: %v", err)
+		return report, err
+	}
 
 	if err := d.Cordon(ctx, node); err != nil {
 		d.log.WithFields(fields).Errorf("drainer: error cordoning node: %v", err)
-		return err
+		return report, err
 	}
 
 	d.log.WithFields(fields).Info("drainer: draining node")
 
-	pods, err := d.getPodsForDeletion(ctx, node)
-	if err != nil {
-		d.log.WithFields(fields).Errorf("drainer: error getting pods: %v", err)
-		return err
+	// let Job Pods run to completion while other Pods are evicted
+	jobs := []v1.Pod{}
+	if d.jobTimeout > 0 {
+		pods, jobs = splitJobPods(pods)
 	}
 
+	if err := d.evictPods(ctx, node, pods, report); err != nil {
+		d.log.WithFields(fields).Errorf("drainer: error evicting pods: %v", err)
+		return report, err
+	}
+
+	if len(jobs) > 0 {
+		d.log.WithFields(fields).Infof("drainer: waiting for %d job pods to complete", len(jobs))
+		jobs, err = d.waitForJobs(ctx, jobs, report)
+		if err != nil {
+			d.log.WithFields(fields).Errorf("drainer: error waiting for job pods: %v", err)
+			return report, err
+		}
+
+		// evict Job Pods still running
+		if err := d.evictPods(ctx, node, jobs, report); err != nil {
+			d.log.WithFields(fields).Errorf("drainer: error evicting job pods: %v", err)
+			return report, err
+		}
+		pods = append(pods, jobs...)
+	}
+
+	if d.waitTimeout > 0 {
+		d.log.WithFields(fields).Info("drainer: waiting for pods to be deleted")
+		if err := d.waitForDeletion(ctx, pods, report); err != nil {
+			d.log.WithFields(fields).Errorf("drainer: error waiting for pods: %v", err)
+			return report, err
+		}
+	}
+
+	d.log.WithFields(fields).Infof("drainer: drained node (%s)", report)
+	return report, nil
+}
+
+// evictPods evicts the given Pods, up to the worker limit at a time.
+// Evictions refused with TooManyRequests (e.g. by a PodDisruptionBudget) are
+// retried with per-Pod backoff while other Pods are evicted, until the context
+// is done. Without a wait timeout, retries are bounded by the retry timeout.
+func (d *drainer) evictPods(ctx context.Context, node string, pods []v1.Pod, report *Report) error {
+	// refusals without a wait timeout aren't a drain timeout
+	timeoutErr := ErrTimeout
+	if d.waitTimeout == 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.retryTimeout)
+		defer cancel()
+		timeoutErr = nil
+	}
+
+	queue := make([]pendingEviction, 0, len(pods))
 	for _, pod := range pods {
-		fields["pod"] = pod.GetName()
-		d.log.WithFields(fields).Info("drainer: evicting pod")
+		queue = append(queue, pendingEviction{
+			pod:    pod,
+			delete: d.filter.DeleteUnmanaged && isUnmanagedPod(pod),
+		})
+	}
 
-		err := d.evictPod(ctx, pod)
+	for {
+		blocked, err := d.evictRound(ctx, node, queue, report)
 		if err != nil {
-			d.log.WithFields(fields).Errorf("drainer: error evicting pod: %v", err)
+			report.failBlocked(blocked)
 			return err
 		}
+
+		if len(blocked) == 0 {
+			return nil
+		}
+
+		// wait for the next Pod eviction retry
+		next := blocked[0].next
+		for _, pending := range blocked {
+			if pending.next.Before(next) {
+				next = pending.next
+			}
+		}
+		select {
+		case <-ctx.Done():
+			report.failBlocked(blocked)
+			return d.blockedError(ctx, blocked, timeoutErr)
+		case <-time.After(time.Until(next)):
+		}
+		queue = blocked
+	}
+}
+
+// evictRound attempts eviction of each queued Pod that is due, concurrently
+// up to the worker limit. Returns the Pods whose eviction was refused or is
+// not yet due, and the first error other than a refusal, if any.
+func (d *drainer) evictRound(ctx context.Context, node string, queue []pendingEviction, report *Report) ([]pendingEviction, error) {
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		blocked  = []pendingEviction{}
+		firstErr error
+	)
+	workers := make(chan struct{}, d.workers)
+
+	for _, pending := range queue {
+		if time.Now().Before(pending.next) {
+			blocked = append(blocked, pending)
+			continue
+		}
+
+		workers <- struct{}{}
+		wg.Add(1)
+		go func(pending pendingEviction) {
+			defer func() {
+				<-workers
+				wg.Done()
+			}()
+
+			fields := logrus.Fields{
+				"node": node,
+				"pod":  pending.pod.GetName(),
+			}
+			var err error
+			if pending.delete {
+				d.log.WithFields(fields).Info("drainer: deleting unmanaged pod")
+				err = d.deletePod(ctx, pending.pod)
+			} else {
+				d.log.WithFields(fields).Info("drainer: evicting pod")
+				err = d.evictPod(ctx, pending.pod)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil && pending.delete:
+				report.delete(pending.pod)
+			case err == nil:
+				report.evict(pending.pod)
+			case apierrors.IsNotFound(err):
+				report.skip(pending.pod, "pod not found")
+			case apierrors.IsTooManyRequests(err):
+				pending.retry(err)
+				d.log.WithFields(fields).Warnf("drainer: eviction refused, retry in %s: %v", time.Until(pending.next).Round(time.Second), err)
+				blocked = append(blocked, pending)
+			case ctx.Err() != nil:
+				// the drain timed out during the eviction
+				d.log.WithFields(fields).Errorf("drainer: error evicting pod: %v", err)
+				report.fail(pending.pod, err.Error())
+				if firstErr == nil {
+					firstErr = fmt.Errorf("%w: evicting pod %s: %v", ErrTimeout, podName(pending.pod), err)
+				}
+			default:
+				d.log.WithFields(fields).Errorf("drainer: error evicting pod: %v", err)
+				report.fail(pending.pod, err.Error())
+				if firstErr == nil {
+					firstErr = err
+				}
+			}
+		}(pending)
+	}
+	wg.Wait()
+
+	return blocked, firstErr
+}
+
+// pendingEviction is a Pod whose eviction is to be retried.
+type pendingEviction struct {
+	pod v1.Pod
+	// delete the Pod rather than evicting it
+	delete  bool
+	next    time.Time
+	backoff time.Duration
+	// most recent refusal
+	err error
+}
+
+// retry schedules the next eviction attempt, respecting the server's
+// suggested delay, if any.
+func (p *pendingEviction) retry(err error) {
+	p.err = err
+	p.backoff = min(max(2*p.backoff, evictionBackoff), maxEvictionBackoff)
+	delay := p.backoff
+	if seconds, ok := apierrors.SuggestsClientDelay(err); ok && seconds > 0 {
+		delay = time.Duration(seconds) * time.Second
+	}
+	p.next = time.Now().Add(delay)
+}
+
+// BlockedError indicates Pod evictions were refused, usually because of
+// PodDisruptionBudgets.
+type BlockedError struct {
+	// namespaced names of Pods whose eviction was refused
+	Pods []string
+	// namespaced names of PodDisruptionBudgets selecting those Pods
+	PDBs []string
+	// underlying error (e.g. ErrTimeout), if any
+	Err error
+}
+
+// Error describes the blocked Pods and PodDisruptionBudgets.
+func (e *BlockedError) Error() string {
+	msg := fmt.Sprintf("drainer: eviction of pods %s refused", strings.Join(e.Pods, ", "))
+	if len(e.PDBs) > 0 {
+		msg = fmt.Sprintf("%s by PodDisruptionBudgets %s", msg, strings.Join(e.PDBs, ", "))
+	}
+	if e.Err != nil {
+		msg = fmt.Sprintf("%s: %v", msg, e.Err)
+	}
+	return msg
+}
+
+// Unwrap returns the underlying error.
+func (e *BlockedError) Unwrap() error {
+	return e.Err
+}
+
+// blockedError returns a BlockedError listing the PodDisruptionBudgets that
+// select the blocked Pods.
+func (d *drainer) blockedError(ctx context.Context, blocked []pendingEviction, err error) *BlockedError {
+	// list PodDisruptionBudgets even if the drain context is done
+	ctx = context.WithoutCancel(ctx)
+
+	blockedErr := &BlockedError{
+		Pods: []string{},
+		PDBs: []string{},
+		Err:  err,
+	}
+	seen := map[string]bool{}
+	for _, pending := range blocked {
+		pod := pending.pod
+		blockedErr.Pods = append(blockedErr.Pods, podName(pod))
+
+		pdbs, err := d.listPDBs(ctx, pod.GetNamespace())
+		if err != nil {
+			d.log.WithField("pod", pod.GetName()).Errorf("drainer: error listing PodDisruptionBudgets: %v", err)
+			continue
+		}
+
+		for _, pdb := range pdbs {
+			selector, err := metav1.LabelSelectorAsSelector(pdb.selector)
+			if err != nil || !selector.Matches(labels.Set(pod.GetLabels())) {
+				continue
+			}
+			if !seen[pdb.name] {
+				seen[pdb.name] = true
+				blockedErr.PDBs = append(blockedErr.PDBs, pdb.name)
+			}
+		}
+	}
+	return blockedErr
+}
+
+// pdbSelector is a PodDisruptionBudget's namespaced name and Pod selector.
+type pdbSelector struct {
+	name     string
+	selector *metav1.LabelSelector
+}
+
+// listPDBs lists a namespace's PodDisruptionBudgets in the policy API version
+// the server uses for Evictions.
+func (d *drainer) listPDBs(ctx context.Context, namespace string) ([]pdbSelector, error) {
+	version, err := d.evictionVersion()
+	if err != nil {
+		return nil, err
+	}
+
+	pdbs := []pdbSelector{}
+	if version == policyv1.SchemeGroupVersion {
+		list, err := d.client.PolicyV1().PodDisruptionBudgets(namespace).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, err
+		}
+		for _, pdb := range list.Items {
+			pdbs = append(pdbs, pdbSelector{pdb.GetNamespace() + "/" + pdb.GetName(), pdb.Spec.Selector})
+		}
+		return pdbs, nil
+	}
+
+	list, err := d.client.PolicyV1beta1().PodDisruptionBudgets(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	for _, pdb := range list.Items {
+		pdbs = append(pdbs, pdbSelector{pdb.GetNamespace() + "/" + pdb.GetName(), pdb.Spec.Selector})
+	}
+	return pdbs, nil
+}
+
+// waitForDeletion waits until the given Pods are deleted or replaced by a Pod
+// of the same name with a different UID, up to the wait timeout. Pods stuck
+// terminating past their grace period are force deleted, if configured.
+func (d *drainer) waitForDeletion(ctx context.Context, pods []v1.Pod, report *Report) error {
+	pending := pods
+	// force delete each Pod at most once (finalizers may keep it)
+	forced := map[types.UID]bool{}
+	err := wait.PollUntilContextTimeout(ctx, d.pollInterval, d.waitTimeout, true, func(ctx context.Context) (bool, error) {
+		remaining := []v1.Pod{}
+		for _, pod := range pending {
+			current, err := d.client.CoreV1().Pods(pod.GetNamespace()).Get(ctx, pod.GetName(), metav1.GetOptions{})
+			if apierrors.IsNotFound(err) || (err == nil && current.GetUID() != pod.GetUID()) {
+				continue
+			}
+			if err != nil {
+				return false, err
+			}
+			if overrun := d.graceOverrun(current); overrun > 0 && !forced[pod.GetUID()] {
+				forced[pod.GetUID()] = true
+				if err := d.forceDeletePod(ctx, current, overrun, report); err != nil {
+					return false, err
+				}
+			}
+			remaining = append(remaining, pod)
+		}
+		pending = remaining
+		return len(pending) == 0, nil
+	})
+	if wait.Interrupted(err) {
+		return fmt.Errorf("%w: %d pods remain", ErrTimeout, len(pending))
+	}
+	return err
+}
+
+// graceOverrun returns how long a terminating Pod has overrun its grace
+// period, if longer than the force delete threshold. Otherwise, returns zero.
+func (d *drainer) graceOverrun(pod *v1.Pod) time.Duration {
+	if d.forceAfter <= 0 || pod.DeletionTimestamp == nil {
+		return 0
+	}
+	// the deletion timestamp is set to the end of the grace period
+	overrun := time.Since(pod.DeletionTimestamp.Time)
+	if overrun <= d.forceAfter {
+		return 0
+	}
+	return overrun
+}
+
+// forceDeletePod deletes a Pod stuck terminating without waiting for its
+// grace period, recording an Event.
+func (d *drainer) forceDeletePod(ctx context.Context, pod *v1.Pod, overrun time.Duration, report *Report) error {
+	fields := logrus.Fields{
+		"node": pod.Spec.NodeName,
+		"pod":  pod.GetName(),
+	}
+	d.log.WithFields(fields).Warnf("drainer: force deleting pod terminating %s past its grace period", overrun.Round(time.Second))
+
+	var zero int64
+	err := d.client.CoreV1().Pods(pod.GetNamespace()).Delete(ctx, pod.GetName(), metav1.DeleteOptions{
+		GracePeriodSeconds: &zero,
+		Preconditions:      metav1.NewUIDPreconditions(string(pod.GetUID())),
+	})
+	if apierrors.IsNotFound(err) || apierrors.IsConflict(err) {
+		return nil
+	}
+	if err != nil {
+		return err
 	}
 
-	d.log.WithFields(fields).Info("drainer: drained node")
+	report.forceDelete(*pod)
+	if d.recorder != nil {
+		d.recorder.Eventf(pod, v1.EventTypeWarning, "ForceDeleted", "Force deleted pod terminating %s past its grace period", overrun.Round(time.Second))
+	}
 	return nil
 }
 
-// Lists pods on a node and filters our mirror and daemonset Pods.
-func (d *drainer) getPodsForDeletion(ctx context.Context, node string) ([]v1.Pod, error) {
+// waitForJobs waits until the given Job Pods complete (or are deleted), up to
+// the job timeout. Returns the Job Pods still running.
+func (d *drainer) waitForJobs(ctx context.Context, pods []v1.Pod, report *Report) ([]v1.Pod, error) {
+	running := pods
+	err := wait.PollUntilContextTimeout(ctx, d.pollInterval, d.jobTimeout, true, func(ctx context.Context) (bool, error) {
+		remaining := []v1.Pod{}
+		for _, pod := range running {
+			current, err := d.client.CoreV1().Pods(pod.GetNamespace()).Get(ctx, pod.GetName(), metav1.GetOptions{})
+			if apierrors.IsNotFound(err) || (err == nil && (current.GetUID() != pod.GetUID() || isTerminalPod(*current))) {
+				report.skip(pod, "job pod completed")
+				continue
+			}
+			if err != nil {
+				return false, err
+			}
+			remaining = append(remaining, pod)
+		}
+		running = remaining
+		return len(running) == 0, nil
+	})
+	if wait.Interrupted(err) {
+		// the drain timed out, rather than the job timeout
+		if ctx.Err() != nil {
+			return running, fmt.Errorf("%w: %d job pods running", ErrTimeout, len(running))
+		}
+		return running, nil
+	}
+	return running, err
+}
+
+// Lists pods on a node and filters out mirror, daemonset, terminal, and
+// skipped Pods.
+// Returns ErrRefused if the filter refuses to drain any Pods.
+func (d *drainer) getPodsForDeletion(ctx context.Context, node string, report *Report) ([]v1.Pod, error) {
 	pods := []v1.Pod{}
+	refused := []v1.Pod{}
 	logFields := logrus.Fields{
 		"node": node,
 	}
@@ -106,26 +689,90 @@ func (d *drainer) getPodsForDeletion(ctx context.Context, node string) ([]v1.Pod
 	for _, pod := range podList.Items {
 		logFields["pod"] = pod.GetName()
 
-		// skip mirror pods
-		if isMirrorPod(pod) {
-			d.log.WithFields(logFields).Debug("skip mirror pod")
+		if reason := d.filter.skip(pod); reason != "" {
+			d.log.WithFields(logFields).Debugf("skip %s", reason)
+			report.skip(pod, reason)
 			continue
 		}
 
-		// skip daemonset pods
-		if isDaemonSetPod(pod) {
-			d.log.WithFields(logFields).Debug("skip daemonset pod")
+		if reason := d.filter.refuse(pod); reason != "" {
+			d.log.WithFields(logFields).Warnf("drainer: refusing to drain %s", reason)
+			report.fail(pod, "refused "+reason)
+			refused = append(refused, pod)
 			continue
 		}
 
 		pods = append(pods, pod)
 	}
 
+	if len(refused) > 0 {
+		names := make([]string, 0, len(refused))
+		for _, pod := range refused {
+			names = append(names, podName(pod))
+		}
+		return nil, fmt.Errorf("%w: pods %s not allowed", ErrRefused, strings.Join(names, ", "))
+	}
 	return pods, nil
 }
 
-// evictPod tries to create an Eviction of the given Pod.
+// skip returns the reason a Pod should not be evicted, if any.
+func (f *Filter) skip(pod v1.Pod) string {
+	switch {
+	case isMirrorPod(pod):
+		return "mirror pod"
+	case isDaemonSetPod(pod):
+		return "daemonset pod"
+	case isTerminalPod(pod):
+		return "terminal pod"
+	case pod.GetAnnotations()[EvictAnnotation] == "false":
+		return "eviction opt-out annotation"
+	case slices.Contains(f.ExcludeNamespaces, pod.GetNamespace()):
+		return "excluded namespace"
+	case f.SkipSelector != nil && !f.SkipSelector.Empty() && f.SkipSelector.Matches(labels.Set(pod.GetLabels())):
+		return "skip selector match"
+	}
+	return ""
+}
+
+// refuse returns the reason a Pod prevents the node being drained, if any.
+func (f *Filter) refuse(pod v1.Pod) string {
+	switch {
+	case f.RefuseLocalStorage && hasLocalStorage(pod):
+		return "pod with local storage"
+	case f.RefuseUnmanaged && isUnmanagedPod(pod):
+		return "pod without a controller"
+	}
+	return ""
+}
+
+// evictPod tries to create an Eviction of the given Pod, using the policy/v1
+// API if the server supports it.
 func (d *drainer) evictPod(ctx context.Context, pod v1.Pod) error {
+	version, err := d.evictionVersion()
+	if err != nil {
+		return err
+	}
+
+	meta := metav1.ObjectMeta{
+		Name:      pod.GetName(),
+		Namespace: pod.GetNamespace(),
+	}
+	deleteOptions := &metav1.DeleteOptions{
+		GracePeriodSeconds: pod.Spec.TerminationGracePeriodSeconds,
+	}
+
+	if version == policyv1.SchemeGroupVersion {
+		// https://pkg.go.dev/k8s.io/api/policy/v1#Eviction
+		eviction := &policyv1.Eviction{
+			TypeMeta: metav1.TypeMeta{
+				APIVersion: "policy/v1",
+				Kind:       "Eviction",
+			},
+			ObjectMeta:    meta,
+			DeleteOptions: deleteOptions,
+		}
+		return d.client.PolicyV1().Evictions(pod.GetNamespace()).Evict(ctx, eviction)
+	}
 
 	// https://pkg.go.dev/k8s.io/api/policy/v1beta1#Eviction
 	eviction := &policyv1beta1.Eviction{
@@ -133,23 +780,86 @@ func (d *drainer) evictPod(ctx context.Context, pod v1.Pod) error {
 			APIVersion: "policy/v1beta1",
 			Kind:       "Eviction",
 		},
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      pod.GetName(),
-			Namespace: pod.GetNamespace(),
-		},
-		DeleteOptions: &metav1.DeleteOptions{
-			GracePeriodSeconds: pod.Spec.TerminationGracePeriodSeconds,
-		},
+		ObjectMeta:    meta,
+		DeleteOptions: deleteOptions,
 	}
-
 	return d.client.PolicyV1beta1().Evictions(pod.GetNamespace()).Evict(ctx, eviction)
 }
 
-// setUnschedulable updates a Node's spec to mark it unschedulable or not.
-func (d *drainer) setUnschedulable(ctx context.Context, node string, unschedule bool) error {
-	patch := []byte(fmt.Sprintf("{\"spec\":{\"unschedulable\":%t}}", unschedule))
-	_, err := d.client.CoreV1().Nodes().Patch(ctx, node, types.StrategicMergePatchType, patch, metav1.PatchOptions{})
-	return err
+// evictionVersion discovers the policy API version the server uses for Pod
+// Evictions, falling back to policy/v1beta1 on older servers. Successful
+// discovery is cached for the drainer's lifetime.
+func (d *drainer) evictionVersion() (schema.GroupVersion, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.eviction != nil {
+		return *d.eviction, nil
+	}
+
+	// Eviction subresources list their version since Kubernetes v1.8
+	resources, err := d.client.Discovery().ServerResourcesForGroupVersion("v1")
+	if err != nil {
+		return schema.GroupVersion{}, fmt.Errorf("drainer: error discovering eviction support: %v", err)
+	}
+
+	version := policyv1beta1.SchemeGroupVersion
+	for _, resource := range resources.APIResources {
+		if resource.Name == "pods/eviction" && resource.Kind == "Eviction" && resource.Group == policyv1.GroupName && resource.Version == "v1" {
+			version = policyv1.SchemeGroupVersion
+		}
+	}
+	d.log.Debugf("drainer: using %s evictions", version)
+	d.eviction = &version
+	return version, nil
+}
+
+// deletePod deletes the given Pod, bypassing PodDisruptionBudgets.
+func (d *drainer) deletePod(ctx context.Context, pod v1.Pod) error {
+	return d.client.CoreV1().Pods(pod.GetNamespace()).Delete(ctx, pod.GetName(), metav1.DeleteOptions{
+		GracePeriodSeconds: pod.Spec.TerminationGracePeriodSeconds,
+	})
+}
+
+// updateNode applies the modify function to the current Node and updates it,
+// if changed. Updates are retried if the Node changed since it was read.
+func (d *drainer) updateNode(ctx context.Context, name string, modify func(*v1.Node) (bool, error)) error {
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		node, err := d.client.CoreV1().Nodes().Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+
+		changed, err := modify(node)
+		if err != nil || !changed {
+			return err
+		}
+
+		_, err = d.client.CoreV1().Nodes().Update(ctx, node, metav1.UpdateOptions{})
+		return err
+	})
+}
+
+// hasTaint returns true if the taints include the given taint, with the same
+// key, value, and effect.
+func hasTaint(taints []v1.Taint, taint *v1.Taint) bool {
+	for _, t := range taints {
+		if t.MatchTaint(taint) && t.Value == taint.Value {
+			return true
+		}
+	}
+	return false
+}
+
+// removeTaint returns the taints without those matching the given taint's key
+// and effect, and whether any were removed.
+func removeTaint(taints []v1.Taint, taint *v1.Taint) ([]v1.Taint, bool) {
+	remaining := []v1.Taint{}
+	for _, t := range taints {
+		if !t.MatchTaint(taint) {
+			remaining = append(remaining, t)
+		}
+	}
+	return remaining, len(remaining) != len(taints)
 }
 
 // isMirrorPod returns true if a Pod is a mirror Pod (i.e. annotated with
@@ -170,3 +880,48 @@ func isDaemonSetPod(pod v1.Pod) bool {
 
 	return controller.Kind == "DaemonSet"
 }
+
+// isUnmanagedPod returns true if a Pod has no controller to replace it.
+func isUnmanagedPod(pod v1.Pod) bool {
+	return metav1.GetControllerOf(&pod) == nil
+}
+
+// hasLocalStorage returns true if a Pod uses emptyDir volumes, whose data is
+// lost when the Pod is evicted.
+func hasLocalStorage(pod v1.Pod) bool {
+	for _, volume := range pod.Spec.Volumes {
+		if volume.EmptyDir != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// isTerminalPod returns true if a Pod has Succeeded or Failed, so evicting it
+// has no effect.
+func isTerminalPod(pod v1.Pod) bool {
+	return pod.Status.Phase == v1.PodSucceeded || pod.Status.Phase == v1.PodFailed
+}
+
+// isJobPod returns true if a Pod is owned by a batch/v1 Job controller.
+func isJobPod(pod v1.Pod) bool {
+	controller := metav1.GetControllerOf(&pod)
+	if controller == nil {
+		return false
+	}
+
+	return controller.Kind == "Job" && controller.APIVersion == "batch/v1"
+}
+
+// splitJobPods separates Job Pods from other Pods.
+func splitJobPods(pods []v1.Pod) ([]v1.Pod, []v1.Pod) {
+	others, jobs := []v1.Pod{}, []v1.Pod{}
+	for _, pod := range pods {
+		if isJobPod(pod) {
+			jobs = append(jobs, pod)
+		} else {
+			others = append(others, pod)
+		}
+	}
+	return others, jobs
+}
@@ -0,0 +1,514 @@
+package drain
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/api/core/v1"
+	policyv1 "k8s.io/api/policy/v1"
+	policyv1beta1 "k8s.io/api/policy/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/record"
+)
+
+// testPod returns a Pod on the node with the given name and UID.
+func testPod(name, uid string) *v1.Pod {
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "default",
+			UID:       types.UID(uid),
+		},
+		Spec: v1.PodSpec{
+			NodeName: "node1",
+		},
+	}
+}
+
+// serveEvictions makes the fake client's discovery list the Pod eviction
+// subresource in the given policy API version.
+func serveEvictions(client *fake.Clientset, version string) {
+	client.Fake.Resources = []*metav1.APIResourceList{
+		{
+			GroupVersion: "v1",
+			APIResources: []metav1.APIResource{
+				{Name: "pods", Kind: "Pod", Namespaced: true},
+				{Name: "pods/eviction", Kind: "Eviction", Group: "policy", Version: version, Namespaced: true},
+			},
+		},
+	}
+}
+
+// newTestDrainer returns a drainer with a fake client and short intervals.
+func newTestDrainer(client *fake.Clientset, timeout time.Duration) *drainer {
+	if client.Fake.Resources == nil {
+		serveEvictions(client, "v1")
+	}
+	return New(&Config{
+		Client:       client,
+		Logger:       logrus.New(),
+		WaitTimeout:  timeout,
+		PollInterval: 10 * time.Millisecond,
+	}).(*drainer)
+}
+
+func TestWaitForDeletion(t *testing.T) {
+	ctx := context.Background()
+	deleted := testPod("deleted", "1")
+	replaced := testPod("replaced", "2")
+	stuck := testPod("stuck", "3")
+
+	// deleted and replaced Pods are gone
+	client := fake.NewClientset(testPod("replaced", "4"))
+	d := newTestDrainer(client, time.Second)
+	err := d.waitForDeletion(ctx, []v1.Pod{*deleted, *replaced}, newReport())
+	assert.Nil(t, err)
+
+	// Pods deleted while waiting
+	client = fake.NewClientset(stuck)
+	d = newTestDrainer(client, 5*time.Second)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		client.CoreV1().Pods("default").Delete(ctx, "stuck", metav1.DeleteOptions{})
+	}()
+	err = d.waitForDeletion(ctx, []v1.Pod{*stuck}, newReport())
+	assert.Nil(t, err)
+
+	// Pods stuck terminating past their grace period are force deleted once
+	terminating := testPod("terminating", "5")
+	terminating.DeletionTimestamp = &metav1.Time{Time: time.Now().Add(-time.Minute)}
+	client = fake.NewClientset(terminating)
+	recorder := record.NewFakeRecorder(10)
+	d = New(&Config{
+		Client:           client,
+		Logger:           logrus.New(),
+		WaitTimeout:      time.Second,
+		PollInterval:     10 * time.Millisecond,
+		ForceDeleteAfter: 30 * time.Second,
+		Recorder:         recorder,
+	}).(*drainer)
+	report := newReport()
+	err = d.waitForDeletion(ctx, []v1.Pod{*terminating}, report)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"default/terminating"}, report.ForceDeleted)
+	assert.Len(t, recorder.Events, 1)
+	assert.Contains(t, <-recorder.Events, "Warning ForceDeleted")
+
+	// but not within the grace overrun
+	client = fake.NewClientset(terminating)
+	d.client = client
+	d.forceAfter = 5 * time.Minute
+	d.waitTimeout = 50 * time.Millisecond
+	report = newReport()
+	err = d.waitForDeletion(ctx, []v1.Pod{*terminating}, report)
+	assert.True(t, errors.Is(err, ErrTimeout))
+	assert.Empty(t, report.ForceDeleted)
+
+	// Pods remaining after the timeout
+	client = fake.NewClientset(stuck)
+	d = newTestDrainer(client, 50*time.Millisecond)
+	err = d.waitForDeletion(ctx, []v1.Pod{*stuck}, newReport())
+	assert.True(t, errors.Is(err, ErrTimeout))
+}
+
+// refuseEvictions makes the first refusals evictions of each Pod fail with
+// TooManyRequests, as a PodDisruptionBudget would.
+func refuseEvictions(client *fake.Clientset, refusals int) {
+	attempts := map[string]int{}
+	client.PrependReactor("create", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if action.GetSubresource() != "eviction" {
+			return false, nil, nil
+		}
+		name := action.(k8stesting.CreateAction).GetObject().(metav1.Object).GetName()
+		attempts[name]++
+		if attempts[name] <= refusals {
+			return true, nil, apierrors.NewTooManyRequests("Cannot evict pod as it would violate the pod's disruption budget.", 0)
+		}
+		return true, nil, nil
+	})
+}
+
+func TestEvictPodsBlocked(t *testing.T) {
+	ctx := context.Background()
+	web := testPod("web", "1")
+	web.Labels = map[string]string{"app": "web"}
+	db := testPod("db", "2")
+	db.Labels = map[string]string{"app": "db"}
+	pdb := &policyv1.PodDisruptionBudget{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "web",
+			Namespace: "default",
+		},
+		Spec: policyv1.PodDisruptionBudgetSpec{
+			Selector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{"app": "web"},
+			},
+		},
+	}
+
+	// without waiting, refused evictions are retried up to the retry timeout
+	client := fake.NewClientset(web, db, pdb)
+	refuseEvictions(client, 1)
+	d := newTestDrainer(client, 0)
+	d.retryTimeout = 5 * time.Second
+	report := newReport()
+	err := d.evictPods(ctx, "node1", []v1.Pod{*web}, report)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"default/web"}, report.Evicted)
+
+	// then report blocking PDBs
+	client = fake.NewClientset(web, db, pdb)
+	refuseEvictions(client, 100)
+	d = newTestDrainer(client, 0)
+	d.retryTimeout = 100 * time.Millisecond
+	report = newReport()
+	err = d.evictPods(ctx, "node1", []v1.Pod{*web}, report)
+	blocked := &BlockedError{}
+	assert.True(t, errors.As(err, &blocked))
+	assert.Equal(t, []string{"default/web"}, blocked.Pods)
+	assert.Equal(t, []string{"default/web"}, blocked.PDBs)
+	assert.False(t, errors.Is(err, ErrTimeout))
+	assert.Equal(t, "default/web", report.Failed[0].Pod)
+	assert.Contains(t, report.Failed[0].Reason, "disruption budget")
+
+	// when waiting, refused evictions are retried
+	client = fake.NewClientset(web, db, pdb)
+	refuseEvictions(client, 1)
+	d = newTestDrainer(client, 5*time.Second)
+	report = newReport()
+	err = d.evictPods(ctx, "node1", []v1.Pod{*web, *db}, report)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"default/db", "default/web"}, report.Evicted)
+
+	// until the drain times out
+	client = fake.NewClientset(web, db, pdb)
+	refuseEvictions(client, 100)
+	d = newTestDrainer(client, time.Second)
+	timeoutCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	err = d.evictPods(timeoutCtx, "node1", []v1.Pod{*web, *db}, newReport())
+	assert.True(t, errors.As(err, &blocked))
+	assert.True(t, errors.Is(err, ErrTimeout))
+	assert.ElementsMatch(t, []string{"default/web", "default/db"}, blocked.Pods)
+	assert.Equal(t, []string{"default/web"}, blocked.PDBs)
+
+	// PDBs are listed in the policy/v1beta1 API on older servers
+	betaPDB := &policyv1beta1.PodDisruptionBudget{
+		ObjectMeta: pdb.ObjectMeta,
+		Spec: policyv1beta1.PodDisruptionBudgetSpec{
+			Selector: pdb.Spec.Selector,
+		},
+	}
+	client = fake.NewClientset(web, betaPDB)
+	serveEvictions(client, "v1beta1")
+	refuseEvictions(client, 100)
+	d = newTestDrainer(client, 0)
+	d.retryTimeout = 100 * time.Millisecond
+	err = d.evictPods(ctx, "node1", []v1.Pod{*web}, newReport())
+	assert.True(t, errors.As(err, &blocked))
+	assert.Equal(t, []string{"default/web"}, blocked.PDBs)
+
+	// or times out during an eviction
+	client = fake.NewClientset(web)
+	client.PrependReactor("create", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		time.Sleep(100 * time.Millisecond)
+		return true, nil, context.DeadlineExceeded
+	})
+	d = newTestDrainer(client, time.Second)
+	timeoutCtx, cancel = context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	err = d.evictPods(timeoutCtx, "node1", []v1.Pod{*web}, newReport())
+	assert.True(t, errors.Is(err, ErrTimeout))
+}
+
+func TestEvictPodVersion(t *testing.T) {
+	ctx := context.Background()
+	cases := []struct {
+		version  string
+		expected runtime.Object
+	}{
+		{"v1", &policyv1.Eviction{}},
+		{"v1beta1", &policyv1beta1.Eviction{}},
+	}
+
+	for _, c := range cases {
+		pod := testPod("web", "1")
+		client := fake.NewClientset(pod)
+		serveEvictions(client, c.version)
+		var eviction runtime.Object
+		client.PrependReactor("create", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			if action.GetSubresource() != "eviction" {
+				return false, nil, nil
+			}
+			eviction = action.(k8stesting.CreateAction).GetObject()
+			return true, nil, nil
+		})
+
+		d := newTestDrainer(client, 0)
+		err := d.evictPod(ctx, *pod)
+		assert.Nil(t, err)
+		assert.IsType(t, c.expected, eviction)
+		assert.Equal(t, "web", eviction.(metav1.Object).GetName())
+	}
+
+	// discovery errors are returned and not cached
+	client := fake.NewClientset()
+	d := newTestDrainer(client, 0)
+	client.Fake.Resources = []*metav1.APIResourceList{}
+	err := d.evictPod(ctx, *testPod("web", "1"))
+	assert.NotNil(t, err)
+	assert.Nil(t, d.eviction)
+}
+
+func TestDrainReport(t *testing.T) {
+	ctx := context.Background()
+	node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}}
+	mirror := testPod("mirror", "1")
+	mirror.Annotations = map[string]string{v1.MirrorPodAnnotationKey: "hash"}
+	broken := testPod("broken", "2")
+	objects := []runtime.Object{node, mirror, broken}
+	for i := 0; i < 20; i++ {
+		objects = append(objects, testPod(fmt.Sprintf("web-%02d", i), fmt.Sprintf("web-%d", i)))
+	}
+	client := fake.NewClientset(objects...)
+
+	client.PrependReactor("create", "pods", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if action.GetSubresource() != "eviction" {
+			return false, nil, nil
+		}
+		if action.(k8stesting.CreateAction).GetObject().(metav1.Object).GetName() == "broken" {
+			return true, nil, apierrors.NewInternalError(errors.New("boom"))
+		}
+		return true, nil, nil
+	})
+
+	d := newTestDrainer(client, 0)
+	d.workers = 4
+	report, err := d.Drain(ctx, "node1")
+	assert.NotNil(t, err)
+	assert.Len(t, report.Evicted, 20)
+	assert.Equal(t, []PodResult{{Pod: "default/mirror", Reason: "mirror pod"}}, report.Skipped)
+	assert.Len(t, report.Failed, 1)
+	assert.Equal(t, "default/broken", report.Failed[0].Pod)
+	assert.Contains(t, report.Failed[0].Reason, "boom")
+	assert.Equal(t, "20 evicted, 0 deleted, 0 force deleted, 1 skipped, 1 failed", report.String())
+}
+
+func TestFilter(t *testing.T) {
+	controller := true
+	managed := func(pod *v1.Pod) *v1.Pod {
+		pod.OwnerReferences = []metav1.OwnerReference{{Kind: "ReplicaSet", Name: "web", Controller: &controller}}
+		return pod
+	}
+	plain := managed(testPod("web", "1"))
+	mirror := managed(testPod("mirror", "2"))
+	mirror.Annotations = map[string]string{v1.MirrorPodAnnotationKey: "hash"}
+	optOut := managed(testPod("opt-out", "3"))
+	optOut.Annotations = map[string]string{EvictAnnotation: "false"}
+	system := managed(testPod("dns", "4"))
+	system.Namespace = "kube-system"
+	batch := managed(testPod("batch", "5"))
+	batch.Labels = map[string]string{"tier": "batch"}
+	scratch := managed(testPod("scratch", "6"))
+	scratch.Spec.Volumes = []v1.Volume{{Name: "tmp", VolumeSource: v1.VolumeSource{EmptyDir: &v1.EmptyDirVolumeSource{}}}}
+	unmanaged := testPod("bare", "7")
+	completed := managed(testPod("completed", "8"))
+	completed.Status.Phase = v1.PodSucceeded
+
+	filter := Filter{
+		RefuseLocalStorage: true,
+		RefuseUnmanaged:    true,
+		SkipSelector:       labels.SelectorFromSet(labels.Set{"tier": "batch"}),
+		ExcludeNamespaces:  []string{"kube-system"},
+	}
+	cases := []struct {
+		pod    *v1.Pod
+		skip   string
+		refuse string
+	}{
+		{plain, "", ""},
+		{mirror, "mirror pod", ""},
+		{completed, "terminal pod", ""},
+		{optOut, "eviction opt-out annotation", ""},
+		{system, "excluded namespace", ""},
+		{batch, "skip selector match", ""},
+		{scratch, "", "pod with local storage"},
+		{unmanaged, "", "pod without a controller"},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.skip, filter.skip(*c.pod), c.pod.GetName())
+		assert.Equal(t, c.refuse, filter.refuse(*c.pod), c.pod.GetName())
+	}
+
+	// by default, Pods are evicted
+	filter = Filter{}
+	for _, pod := range []*v1.Pod{plain, batch, scratch, unmanaged} {
+		assert.Empty(t, filter.skip(*pod))
+		assert.Empty(t, filter.refuse(*pod))
+	}
+}
+
+func TestDrainFiltered(t *testing.T) {
+	ctx := context.Background()
+	node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}}
+	scratch := testPod("scratch", "1")
+	scratch.Spec.Volumes = []v1.Volume{{Name: "tmp", VolumeSource: v1.VolumeSource{EmptyDir: &v1.EmptyDirVolumeSource{}}}}
+	unmanaged := testPod("bare", "2")
+
+	// refused Pods fail the drain before evicting
+	client := fake.NewClientset(node, scratch, unmanaged)
+	d := newTestDrainer(client, 0)
+	d.filter = Filter{RefuseLocalStorage: true}
+	report, err := d.Drain(ctx, "node1")
+	assert.True(t, errors.Is(err, ErrRefused))
+	assert.Empty(t, report.Evicted)
+	assert.Equal(t, []PodResult{{Pod: "default/scratch", Reason: "refused pod with local storage"}}, report.Failed)
+
+	// unmanaged Pods may be deleted rather than evicted
+	controller := true
+	scratch.OwnerReferences = []metav1.OwnerReference{{Kind: "ReplicaSet", Name: "scratch", Controller: &controller}}
+	client = fake.NewClientset(node, scratch, unmanaged)
+	d = newTestDrainer(client, 0)
+	d.filter = Filter{DeleteUnmanaged: true}
+	report, err = d.Drain(ctx, "node1")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"default/bare"}, report.Deleted)
+	assert.Equal(t, []string{"default/scratch"}, report.Evicted)
+	_, err = client.CoreV1().Pods("default").Get(ctx, "bare", metav1.GetOptions{})
+	assert.True(t, apierrors.IsNotFound(err))
+}
+
+func TestDrainJobPods(t *testing.T) {
+	ctx := context.Background()
+	node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}}
+	controller := true
+	jobPod := func(name, uid string) *v1.Pod {
+		pod := testPod(name, uid)
+		pod.OwnerReferences = []metav1.OwnerReference{{APIVersion: "batch/v1", Kind: "Job", Name: name, Controller: &controller}}
+		pod.Status.Phase = v1.PodRunning
+		return pod
+	}
+	finishing := jobPod("finishing", "1")
+	stuck := jobPod("stuck", "2")
+	web := testPod("web", "3")
+
+	client := fake.NewClientset(node, finishing, stuck, web)
+	d := newTestDrainer(client, 0)
+	d.jobTimeout = 200 * time.Millisecond
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		finished := finishing.DeepCopy()
+		finished.Status.Phase = v1.PodSucceeded
+		client.CoreV1().Pods("default").UpdateStatus(ctx, finished, metav1.UpdateOptions{})
+	}()
+
+	// completed Job Pods are skipped, Job Pods still running are evicted
+	report, err := d.Drain(ctx, "node1")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"default/stuck", "default/web"}, report.Evicted)
+	assert.Equal(t, []PodResult{{Pod: "default/finishing", Reason: "job pod completed"}}, report.Skipped)
+
+	// unless the drain times out first
+	client = fake.NewClientset(node, stuck)
+	d = newTestDrainer(client, 50*time.Millisecond)
+	d.jobTimeout = time.Second
+	_, err = d.Drain(ctx, "node1")
+	assert.True(t, errors.Is(err, ErrTimeout))
+}
+
+func TestCordonTaint(t *testing.T) {
+	ctx := context.Background()
+	other := v1.Taint{Key: "example.com/gpu", Value: "true", Effect: v1.TaintEffectNoSchedule}
+	taint := &v1.Taint{Key: "fleetlock.poseidon/rebooting", Effect: v1.TaintEffectNoExecute}
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "node1"},
+		Spec: v1.NodeSpec{
+			Taints: []v1.Taint{other},
+		},
+	}
+
+	cases := []struct {
+		taintOnly     bool
+		unschedulable bool
+	}{
+		{taintOnly: false, unschedulable: true},
+		{taintOnly: true, unschedulable: false},
+	}
+	for _, c := range cases {
+		client := fake.NewClientset(node)
+		d := New(&Config{
+			Client:    client,
+			Logger:    logrus.New(),
+			Taint:     taint,
+			TaintOnly: c.taintOnly,
+		})
+
+		// cordoning merges the taint with other taints, once
+		assert.Nil(t, d.Cordon(ctx, "node1"))
+		assert.Nil(t, d.Cordon(ctx, "node1"))
+		current, err := client.CoreV1().Nodes().Get(ctx, "node1", metav1.GetOptions{})
+		assert.Nil(t, err)
+		assert.Equal(t, []v1.Taint{other, *taint}, current.Spec.Taints)
+		assert.Equal(t, c.unschedulable, current.Spec.Unschedulable)
+
+		// uncordoning removes exactly the taint
+		assert.Nil(t, d.Uncordon(ctx, "node1"))
+		current, err = client.CoreV1().Nodes().Get(ctx, "node1", metav1.GetOptions{})
+		assert.Nil(t, err)
+		assert.Equal(t, []v1.Taint{other}, current.Spec.Taints)
+		assert.False(t, current.Spec.Unschedulable)
+	}
+}
+
+func TestCordonOwnership(t *testing.T) {
+	ctx := context.Background()
+	node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}}
+	client := fake.NewClientset(node)
+	d := New(&Config{
+		Client: client,
+		Logger: logrus.New(),
+		Group:  "workers",
+	})
+
+	// cordoning records a marker, which uncordoning removes
+	assert.Nil(t, d.Cordon(ctx, "node1"))
+	current, err := client.CoreV1().Nodes().Get(ctx, "node1", metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.True(t, current.Spec.Unschedulable)
+	marker := &CordonMarker{}
+	assert.Nil(t, json.Unmarshal([]byte(current.Annotations[CordonAnnotation]), marker))
+	assert.Equal(t, "workers", marker.Group)
+	assert.WithinDuration(t, time.Now(), marker.Time, time.Minute)
+
+	assert.Nil(t, d.Uncordon(ctx, "node1"))
+	current, err = client.CoreV1().Nodes().Get(ctx, "node1", metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.False(t, current.Spec.Unschedulable)
+	assert.NotContains(t, current.Annotations, CordonAnnotation)
+
+	// Nodes cordoned by others are left unschedulable
+	node.Spec.Unschedulable = true
+	client = fake.NewClientset(node)
+	d = New(&Config{
+		Client: client,
+		Logger: logrus.New(),
+	})
+	assert.Nil(t, d.Cordon(ctx, "node1"))
+	assert.Nil(t, d.Uncordon(ctx, "node1"))
+	current, err = client.CoreV1().Nodes().Get(ctx, "node1", metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.True(t, current.Spec.Unschedulable)
+	assert.NotContains(t, current.Annotations, CordonAnnotation)
+}
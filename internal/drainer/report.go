@@ -0,0 +1,98 @@
+package drain
+
+import (
+	"fmt"
+	"sort"
+
+	"k8s.io/api/core/v1"
+)
+
+// Report summarizes the outcome of draining a node's Pods.
+type Report struct {
+	// namespaced names of evicted Pods
+	Evicted []string
+	// namespaced names of deleted Pods
+	Deleted []string
+	// namespaced names of Pods force deleted after terminating too long
+	ForceDeleted []string
+	// Pods that were not evicted and why
+	Skipped []PodResult
+	// Pods whose eviction failed and why
+	Failed []PodResult
+}
+
+// PodResult is the outcome of a Pod that was not evicted.
+type PodResult struct {
+	// namespaced name of the Pod
+	Pod    string
+	Reason string
+}
+
+// newReport returns an empty Report.
+func newReport() *Report {
+	return &Report{
+		Evicted:      []string{},
+		Deleted:      []string{},
+		ForceDeleted: []string{},
+		Skipped:      []PodResult{},
+		Failed:       []PodResult{},
+	}
+}
+
+// String summarizes the number of evicted, deleted, skipped, and failed Pods.
+func (r *Report) String() string {
+	return fmt.Sprintf("%d evicted, %d deleted, %d force deleted, %d skipped, %d failed", len(r.Evicted), len(r.Deleted), len(r.ForceDeleted), len(r.Skipped), len(r.Failed))
+}
+
+// evict records an evicted Pod.
+func (r *Report) evict(pod v1.Pod) {
+	r.Evicted = append(r.Evicted, podName(pod))
+	sort.Strings(r.Evicted)
+}
+
+// delete records a deleted Pod.
+func (r *Report) delete(pod v1.Pod) {
+	r.Deleted = append(r.Deleted, podName(pod))
+	sort.Strings(r.Deleted)
+}
+
+// forceDelete records a force deleted Pod.
+func (r *Report) forceDelete(pod v1.Pod) {
+	r.ForceDeleted = append(r.ForceDeleted, podName(pod))
+	sort.Strings(r.ForceDeleted)
+}
+
+// skip records a Pod that was not evicted.
+func (r *Report) skip(pod v1.Pod, reason string) {
+	r.Skipped = appendResult(r.Skipped, podName(pod), reason)
+}
+
+// fail records a Pod whose eviction failed.
+func (r *Report) fail(pod v1.Pod, reason string) {
+	r.Failed = appendResult(r.Failed, podName(pod), reason)
+}
+
+// failBlocked records Pods whose eviction was refused as failed.
+func (r *Report) failBlocked(blocked []pendingEviction) {
+	for _, pending := range blocked {
+		reason := "eviction not attempted"
+		if pending.err != nil {
+			reason = pending.err.Error()
+		}
+		r.fail(pending.pod, reason)
+	}
+}
+
+// appendResult appends a PodResult, keeping results sorted by Pod.
+func appendResult(results []PodResult, pod, reason string) []PodResult {
+	results = append(results, PodResult{Pod: pod, Reason: reason})
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Pod < results[j].Pod
+	})
+	return results
+}
+
+// podName returns the namespaced name of a Pod.
+func podName(pod v1.Pod) string {
+	return pod.GetNamespace() + "/" + pod.GetName()
+}
@@ -13,6 +13,10 @@ const (
 	KindDecodeError      ReplyKind = "decode_error"
 	KindInternalError    ReplyKind = "internal_error"
 	KindLockHeld         ReplyKind = "lock_held"
+	KindLockContention   ReplyKind = "lock_contention"
+	KindNodeNotReady     ReplyKind = "node_not_ready"
+	KindDrainIncomplete  ReplyKind = "drain_incomplete"
+	KindGroupMismatch    ReplyKind = "group_mismatch"
 )
 
 // ReplyKind is used as a Zincati metrics label.
@@ -34,6 +38,21 @@ func NewReply(kind ReplyKind, format string, a ...interface{}) Reply {
 	}
 }
 
+// denial is an error which denies a request with a Reply.
+type denial struct {
+	reply Reply
+}
+
+// deny returns a denial error with a Reply of a specific kind and message.
+func deny(kind ReplyKind, format string, a ...interface{}) error {
+	return &denial{reply: NewReply(kind, format, a...)}
+}
+
+// Error returns the denial reply value.
+func (d *denial) Error() string {
+	return d.reply.Value
+}
+
 // encodeReply writes response with the given Reply and HTTP code.
 func encodeReply(w http.ResponseWriter, reply Reply) error {
 	w.Header().Set("Content-Type", "application/json")
@@ -48,6 +67,12 @@ func encodeReply(w http.ResponseWriter, reply Reply) error {
 		w.WriteHeader(http.StatusInternalServerError)
 	case KindLockHeld:
 		w.WriteHeader(http.StatusLocked)
+	case KindLockContention:
+		w.WriteHeader(http.StatusConflict)
+	case KindGroupMismatch:
+		w.WriteHeader(http.StatusForbidden)
+	case KindNodeNotReady, KindDrainIncomplete:
+		w.WriteHeader(http.StatusServiceUnavailable)
 	default:
 		w.WriteHeader(http.StatusOK)
 	}
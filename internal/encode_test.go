@@ -40,6 +40,26 @@ func TestEncodeReply(t *testing.T) {
 			expectedStatus:   423,
 			expectedResponse: `{"kind": "lock_held", "value": "reboot lease unavailable, held by e0f3745b108f471cbd4883c6fbed8cdd"}`,
 		},
+		{
+			reply:            NewReply(KindLockContention, "reboot lease lock undecided due to contention, retry"),
+			expectedStatus:   409,
+			expectedResponse: `{"kind": "lock_contention", "value": "reboot lease lock undecided due to contention, retry"}`,
+		},
+		{
+			reply:            NewReply(KindNodeNotReady, "node %s is not Ready", "node1"),
+			expectedStatus:   503,
+			expectedResponse: `{"kind": "node_not_ready", "value": "node node1 is not Ready"}`,
+		},
+		{
+			reply:            NewReply(KindDrainIncomplete, "reboot lease held, but node drain incomplete"),
+			expectedStatus:   503,
+			expectedResponse: `{"kind": "drain_incomplete", "value": "reboot lease held, but node drain incomplete"}`,
+		},
+		{
+			reply:            NewReply(KindGroupMismatch, "group %s doesn't match node %s group %s", "a", "node1", "b"),
+			expectedStatus:   403,
+			expectedResponse: `{"kind": "group_mismatch", "value": "group a doesn't match node node1 group b"}`,
+		},
 		{
 			reply:            NewReply("other", "message"),
 			expectedStatus:   200,
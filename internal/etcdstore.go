@@ -0,0 +1,399 @@
+package fleetlock
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	"go.etcd.io/etcd/client/pkg/v3/transport"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+const (
+	// default etcd key prefix, followed by the group name
+	defaultEtcdPrefix = "/fleetlock/groups"
+)
+
+// EtcdConfig configures an etcd v3 LockStore.
+type EtcdConfig struct {
+	// etcd client endpoints
+	Endpoints []string
+	// key prefix under which group locks are stored
+	Prefix string
+	// TTL of the etcd lease attached to each hold (optional)
+	LeaseTTL time.Duration
+	// client TLS files (optional)
+	CAFile   string
+	CertFile string
+	KeyFile  string
+}
+
+// EtcdStore is a LockStore which stores each group's RebootLock in etcd keys
+// (one per holder), updated by compare-and-swap transactions on the group's
+// key revisions.
+type EtcdStore struct {
+	client   *clientv3.Client
+	prefix   string
+	leaseTTL time.Duration
+	// called on each conflicting update (optional)
+	onConflict func(group string)
+}
+
+// NewEtcdStore returns a LockStore backed by etcd v3.
+func NewEtcdStore(config *EtcdConfig, onConflict func(group string)) (*EtcdStore, error) {
+	if len(config.Endpoints) == 0 {
+		return nil, fmt.Errorf("fleetlock: etcd backend requires endpoints")
+	}
+	if config.LeaseTTL > 0 && config.LeaseTTL < time.Second {
+		return nil, fmt.Errorf("fleetlock: etcd lease TTL must be at least 1s")
+	}
+
+	clientConfig := clientv3.Config{
+		Endpoints:   config.Endpoints,
+		DialTimeout: 5 * time.Second,
+	}
+	if config.CAFile != "" || config.CertFile != "" || config.KeyFile != "" {
+		tlsInfo := transport.TLSInfo{
+			TrustedCAFile: config.CAFile,
+			CertFile:      config.CertFile,
+			KeyFile:       config.KeyFile,
+		}
+		tlsConfig, err := tlsInfo.ClientConfig()
+		if err != nil {
+			return nil, fmt.Errorf("fleetlock: error creating etcd TLS config: %v", err)
+		}
+		clientConfig.TLS = tlsConfig
+	}
+
+	client, err := clientv3.New(clientConfig)
+	if err != nil {
+		return nil, fmt.Errorf("fleetlock: error creating etcd client: %v", err)
+	}
+
+	prefix := config.Prefix
+	if prefix == "" {
+		prefix = defaultEtcdPrefix
+	}
+
+	return &EtcdStore{
+		client:     client,
+		prefix:     prefix,
+		leaseTTL:   config.LeaseTTL,
+		onConflict: onConflict,
+	}, nil
+}
+
+// Close closes the etcd client.
+func (s *EtcdStore) Close() error {
+	return s.client.Close()
+}
+
+// Get returns the RebootLock of a group.
+func (s *EtcdStore) Get(ctx context.Context, group string) (*RebootLock, error) {
+	lock, _, _, err := s.get(ctx, group)
+	return lock, err
+}
+
+// Acquire adds a holder to a group's RebootLock, if admitted.
+func (s *EtcdStore) Acquire(ctx context.Context, group string, holder Holder, admit AdmitFunc) (*RebootLock, bool, error) {
+	acquired := false
+	lock, err := s.modify(ctx, group, func(lock *RebootLock) (*RebootLock, error) {
+		update, err := acquire(lock, holder, admit)
+		acquired = update != nil
+		return update, err
+	})
+	if err == nil && !acquired && lock.Holds(holder.ID) {
+		// a retained hold writes nothing, so keep the hold from expiring
+		if err := s.keepAlive(ctx, group, holder.ID); err != nil {
+			return nil, false, err
+		}
+	}
+	return lock, acquired, err
+}
+
+// keepAlive renews the etcd lease attached to a holder's key, if any.
+func (s *EtcdStore) keepAlive(ctx context.Context, group, id string) error {
+	if s.leaseTTL <= 0 {
+		return nil
+	}
+
+	key, err := s.holderKey(group, id)
+	if err != nil {
+		return err
+	}
+	resp, err := s.client.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	if len(resp.Kvs) == 0 || resp.Kvs[0].Lease == 0 {
+		return nil
+	}
+
+	_, err = s.client.KeepAliveOnce(ctx, clientv3.LeaseID(resp.Kvs[0].Lease))
+	if err == rpctypes.ErrLeaseNotFound {
+		// expired since it was read
+		return nil
+	}
+	return err
+}
+
+// Release removes a holder id from a group's RebootLock, if admitted.
+func (s *EtcdStore) Release(ctx context.Context, group string, id string, admit AdmitFunc) (*RebootLock, error) {
+	return s.modify(ctx, group, func(lock *RebootLock) (*RebootLock, error) {
+		return release(lock, id, admit)
+	})
+}
+
+// List returns the RebootLock of each group with a key.
+func (s *EtcdStore) List(ctx context.Context) (map[string]*RebootLock, error) {
+	resp, err := s.client.Get(ctx, s.prefix+"/", clientv3.WithPrefix())
+	if err != nil {
+		return nil, err
+	}
+
+	locks := map[string]*RebootLock{}
+	lockOf := func(group string) *RebootLock {
+		if _, ok := locks[group]; !ok {
+			locks[group] = &RebootLock{Holders: []Holder{}}
+		}
+		return locks[group]
+	}
+	for _, kv := range resp.Kvs {
+		name := strings.TrimPrefix(string(kv.Key), s.prefix+"/")
+		group, _, isHolder := strings.Cut(name, "/")
+		lock := lockOf(group)
+		if isHolder {
+			holder := Holder{}
+			if err := json.Unmarshal(kv.Value, &holder); err != nil {
+				return nil, fmt.Errorf("fleetlock: error decoding etcd key %s: %v", kv.Key, err)
+			}
+			lock.Holders = append(lock.Holders, holder)
+			continue
+		}
+
+		meta, err := decodeEtcdMeta(kv)
+		if err != nil {
+			return nil, err
+		}
+		lock.LeaseTransitions = meta.LeaseTransitions
+		lock.Holders = mergeHolders(lock.Holders, meta.Holders)
+	}
+	for _, lock := range locks {
+		sortHolders(lock.Holders)
+	}
+	return locks, nil
+}
+
+// key returns the etcd key of a group. Groups are client-supplied, so groups
+// which could escape the key prefix are rejected.
+func (s *EtcdStore) key(group string) (string, error) {
+	if !validKeyName(group) {
+		return "", fmt.Errorf("fleetlock: invalid group %q", group)
+	}
+	return path.Join(s.prefix, group), nil
+}
+
+// holderKey returns the etcd key of a group's holder. Ids are client-supplied
+// too, so ids which could escape the group's keys are rejected.
+func (s *EtcdStore) holderKey(group, id string) (string, error) {
+	key, err := s.key(group)
+	if err != nil {
+		return "", err
+	}
+	if !validKeyName(id) {
+		return "", fmt.Errorf("fleetlock: invalid id %q", id)
+	}
+	return key + "/" + id, nil
+}
+
+// validKeyName returns true if a name is a single, non-relative key segment.
+func validKeyName(name string) bool {
+	return name != "" && name != "." && !strings.Contains(name, "/") && !strings.Contains(name, "..")
+}
+
+// get reads a group's RebootLock, the ids with a holder key, and the etcd
+// revision it was read at.
+func (s *EtcdStore) get(ctx context.Context, group string) (*RebootLock, map[string]bool, int64, error) {
+	key, err := s.key(group)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	resp, err := s.client.Txn(ctx).Then(
+		clientv3.OpGet(key),
+		clientv3.OpGet(key+"/", clientv3.WithPrefix()),
+	).Commit()
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	lock := &RebootLock{Holders: []Holder{}}
+	keyed := map[string]bool{}
+	for _, kv := range resp.Responses[1].GetResponseRange().Kvs {
+		holder := Holder{}
+		if err := json.Unmarshal(kv.Value, &holder); err != nil {
+			return nil, nil, 0, fmt.Errorf("fleetlock: error decoding etcd key %s: %v", kv.Key, err)
+		}
+		lock.Holders = append(lock.Holders, holder)
+		keyed[holder.ID] = true
+	}
+	if kvs := resp.Responses[0].GetResponseRange().Kvs; len(kvs) > 0 {
+		meta, err := decodeEtcdMeta(kvs[0])
+		if err != nil {
+			return nil, nil, 0, err
+		}
+		lock.LeaseTransitions = meta.LeaseTransitions
+		lock.Holders = mergeHolders(lock.Holders, meta.Holders)
+	}
+	sortHolders(lock.Holders)
+	return lock, keyed, resp.Header.Revision, nil
+}
+
+// decodeEtcdMeta decodes a group's key, which stores the RebootLock without
+// holders (or with holders, as written by earlier versions).
+func decodeEtcdMeta(kv *mvccpb.KeyValue) (*RebootLock, error) {
+	meta := &RebootLock{}
+	if err := json.Unmarshal(kv.Value, meta); err != nil {
+		return nil, fmt.Errorf("fleetlock: error decoding etcd key %s: %v", kv.Key, err)
+	}
+	return meta, nil
+}
+
+// mergeHolders adds holders stored in a group's key by earlier versions,
+// unless a holder key exists.
+func mergeHolders(holders []Holder, legacy []Holder) []Holder {
+	for _, holder := range legacy {
+		if !(&RebootLock{Holders: holders}).Holds(holder.ID) {
+			holders = append(holders, holder)
+		}
+	}
+	return holders
+}
+
+// sortHolders orders holders by acquire time.
+func sortHolders(holders []Holder) {
+	sort.SliceStable(holders, func(i, j int) bool {
+		return holders[i].AcquireTime.Before(holders[j].AcquireTime)
+	})
+}
+
+// modify reads a group's RebootLock, passes it to the modify function, and
+// stores the returned RebootLock (if non-nil) only if none of the group's keys
+// changed since it was read. Otherwise, modify is re-evaluated with backoff
+// bounded by the context.
+//
+// Each holder is stored in its own key under the group's key, with its own
+// etcd lease (if configured), so holds expire independently. The group's key
+// stores the lease transitions.
+func (s *EtcdStore) modify(ctx context.Context, group string, modify func(*RebootLock) (*RebootLock, error)) (*RebootLock, error) {
+	key, err := s.key(group)
+	if err != nil {
+		return nil, err
+	}
+
+	// etcd leases granted at most once per holder, revoked unless attached
+	leases := map[string]clientv3.LeaseID{}
+	attached := map[clientv3.LeaseID]bool{}
+	defer func() {
+		for _, lease := range leases {
+			if !attached[lease] {
+				s.client.Revoke(context.Background(), lease)
+			}
+		}
+	}()
+
+	backoff := conflictBackoff
+	for {
+		lock, keyed, revision, err := s.get(ctx, group)
+		if err != nil {
+			return nil, err
+		}
+
+		update, err := modify(lock)
+		if err != nil || update == nil {
+			return lock, err
+		}
+
+		meta, err := json.Marshal(&RebootLock{LeaseTransitions: update.LeaseTransitions})
+		if err != nil {
+			return nil, err
+		}
+		ops := []clientv3.Op{clientv3.OpPut(key, string(meta))}
+
+		// put new (or earlier versions') holders, delete released holders
+		kept := map[string]bool{}
+		puts := map[string]clientv3.LeaseID{}
+		for _, holder := range update.Holders {
+			kept[holder.ID] = true
+			if keyed[holder.ID] {
+				continue
+			}
+			holderKey, err := s.holderKey(group, holder.ID)
+			if err != nil {
+				return nil, err
+			}
+			value, err := json.Marshal(holder)
+			if err != nil {
+				return nil, err
+			}
+
+			// holds expire with an etcd lease, if configured
+			opts := []clientv3.OpOption{}
+			if s.leaseTTL > 0 {
+				lease, ok := leases[holder.ID]
+				if !ok {
+					resp, err := s.client.Grant(ctx, int64(s.leaseTTL.Seconds()))
+					if err != nil {
+						return nil, err
+					}
+					lease = resp.ID
+					leases[holder.ID] = lease
+				}
+				opts = append(opts, clientv3.WithLease(lease))
+				puts[holder.ID] = lease
+			}
+			ops = append(ops, clientv3.OpPut(holderKey, string(value), opts...))
+		}
+		for id := range keyed {
+			if !kept[id] {
+				ops = append(ops, clientv3.OpDelete(key+"/"+id))
+			}
+		}
+
+		resp, err := s.client.Txn(ctx).
+			If(
+				clientv3.Compare(clientv3.ModRevision(key), "<", revision+1),
+				clientv3.Compare(clientv3.ModRevision(key+"/").WithPrefix(), "<", revision+1),
+			).
+			Then(ops...).
+			Commit()
+		if err != nil {
+			return nil, err
+		}
+		if resp.Succeeded {
+			for _, lease := range puts {
+				attached[lease] = true
+			}
+			return update, nil
+		}
+
+		if s.onConflict != nil {
+			s.onConflict(group)
+		}
+		if backoff.Steps <= 1 {
+			return nil, ErrLockContention
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ErrLockContention
+		case <-time.After(backoff.Step()):
+		}
+	}
+}
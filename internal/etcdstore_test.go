@@ -0,0 +1,176 @@
+package fleetlock
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.etcd.io/etcd/server/v3/embed"
+)
+
+// freeURL returns an http URL on a free localhost port.
+func freeURL(t *testing.T) url.URL {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	defer l.Close()
+	return url.URL{Scheme: "http", Host: l.Addr().String()}
+}
+
+// newTestEtcd starts an embedded etcd server and returns its client endpoint.
+func newTestEtcd(t *testing.T) string {
+	config := embed.NewConfig()
+	config.Dir = t.TempDir()
+	config.LogLevel = "error"
+	clientURL, peerURL := freeURL(t), freeURL(t)
+	config.ListenClientUrls = []url.URL{clientURL}
+	config.AdvertiseClientUrls = []url.URL{clientURL}
+	config.ListenPeerUrls = []url.URL{peerURL}
+	config.AdvertisePeerUrls = []url.URL{peerURL}
+	config.InitialCluster = fmt.Sprintf("%s=%s", config.Name, peerURL.String())
+
+	server, err := embed.StartEtcd(config)
+	require.Nil(t, err)
+	t.Cleanup(server.Close)
+
+	select {
+	case <-server.Server.ReadyNotify():
+	case <-time.After(30 * time.Second):
+		t.Fatal("embedded etcd not ready")
+	}
+	return clientURL.String()
+}
+
+func TestEtcdStore(t *testing.T) {
+	endpoint := newTestEtcd(t)
+	store, err := NewEtcdStore(&EtcdConfig{Endpoints: []string{endpoint}}, nil)
+	require.Nil(t, err)
+	defer store.Close()
+
+	testLockStore(t, store)
+
+	// concurrent writers conflict and re-evaluate admission
+	ctx := context.Background()
+	results := make(chan bool, 5)
+	for i := 0; i < 5; i++ {
+		go func(id string) {
+			_, acquired, err := store.Acquire(ctx, "racing", Holder{ID: id, AcquireTime: time.Now()}, func(lock *RebootLock) error {
+				if len(lock.Holders) >= 1 {
+					return fmt.Errorf("held")
+				}
+				return nil
+			})
+			results <- err == nil && acquired
+		}(fmt.Sprintf("node-%d", i))
+	}
+
+	obtained := 0
+	for i := 0; i < 5; i++ {
+		if <-results {
+			obtained++
+		}
+	}
+	assert.Equal(t, 1, obtained)
+
+	lock, err := store.Get(ctx, "racing")
+	assert.Nil(t, err)
+	assert.Len(t, lock.Holders, 1)
+}
+
+func TestEtcdStoreLeaseTTLValidation(t *testing.T) {
+	_, err := NewEtcdStore(&EtcdConfig{Endpoints: []string{"http://127.0.0.1:2379"}, LeaseTTL: 500 * time.Millisecond}, nil)
+	assert.NotNil(t, err)
+}
+
+func TestEtcdStoreKey(t *testing.T) {
+	store := &EtcdStore{prefix: "/fleetlock/groups"}
+
+	key, err := store.key("workers")
+	assert.Nil(t, err)
+	assert.Equal(t, "/fleetlock/groups/workers", key)
+
+	key, err = store.holderKey("workers", "a")
+	assert.Nil(t, err)
+	assert.Equal(t, "/fleetlock/groups/workers/a", key)
+
+	// groups and ids can't escape the prefix
+	for _, name := range []string{"", ".", "..", "../../x", "a/b", "a..b"} {
+		_, err := store.key(name)
+		assert.NotNil(t, err, name)
+		_, err = store.holderKey("workers", name)
+		assert.NotNil(t, err, name)
+	}
+}
+
+func TestEtcdStoreLeaseTTL(t *testing.T) {
+	endpoint := newTestEtcd(t)
+	store, err := NewEtcdStore(&EtcdConfig{
+		Endpoints: []string{endpoint},
+		Prefix:    "/test",
+		LeaseTTL:  2 * time.Second,
+	}, nil)
+	require.Nil(t, err)
+	defer store.Close()
+
+	ctx := context.Background()
+	admit := func(*RebootLock) error { return nil }
+	_, acquired, err := store.Acquire(ctx, "default", Holder{ID: "a", AcquireTime: time.Now()}, admit)
+	assert.Nil(t, err)
+	assert.True(t, acquired)
+	_, acquired, err = store.Acquire(ctx, "default", Holder{ID: "b", AcquireTime: time.Now()}, admit)
+	assert.Nil(t, err)
+	assert.True(t, acquired)
+
+	// each hold has its own etcd lease, renewed only by its holder
+	leases, err := store.client.Leases(ctx)
+	assert.Nil(t, err)
+	assert.Len(t, leases.Leases, 2)
+	for i := 0; i < 3; i++ {
+		time.Sleep(time.Second)
+		_, acquired, err = store.Acquire(ctx, "default", Holder{ID: "b", AcquireTime: time.Now()}, admit)
+		assert.Nil(t, err)
+		assert.False(t, acquired)
+	}
+
+	// holds expire independently, keeping lease transitions
+	assert.Eventually(t, func() bool {
+		lock, err := store.Get(ctx, "default")
+		return err == nil && len(lock.Holders) == 1
+	}, 10*time.Second, 250*time.Millisecond)
+	lock, err := store.Get(ctx, "default")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"b"}, lock.HolderIDs())
+	assert.Equal(t, int32(2), lock.LeaseTransitions)
+}
+
+func TestEtcdStoreLegacyKey(t *testing.T) {
+	endpoint := newTestEtcd(t)
+	store, err := NewEtcdStore(&EtcdConfig{Endpoints: []string{endpoint}, Prefix: "/test"}, nil)
+	require.Nil(t, err)
+	defer store.Close()
+
+	// holders stored in the group's key by earlier versions are kept
+	ctx := context.Background()
+	_, err = store.client.Put(ctx, "/test/default", `{"holders":[{"id":"a","acquireTime":"2024-01-01T00:00:00Z"}],"leaseTransitions":1}`)
+	require.Nil(t, err)
+	lock, err := store.Get(ctx, "default")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a"}, lock.HolderIDs())
+
+	// and moved to holder keys on update
+	_, acquired, err := store.Acquire(ctx, "default", Holder{ID: "b", AcquireTime: time.Now()}, func(*RebootLock) error { return nil })
+	assert.Nil(t, err)
+	assert.True(t, acquired)
+	lock, err = store.Release(ctx, "default", "a", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"b"}, lock.HolderIDs())
+
+	locks, err := store.List(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"b"}, locks["default"].HolderIDs())
+	assert.Equal(t, int32(2), locks["default"].LeaseTransitions)
+}
@@ -0,0 +1,50 @@
+package fleetlock
+
+import (
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// List of Event reasons
+const (
+	reasonLockObtained   = "RebootLockObtained"
+	reasonLockDenied     = "RebootLockDenied"
+	reasonLockFailed     = "RebootLockFailed"
+	reasonLockReleased   = "RebootLockReleased"
+	reasonUnlockDenied   = "RebootUnlockDenied"
+	reasonDrainStarted   = "DrainStarted"
+	reasonDrained        = "Drained"
+	reasonDrainFailed    = "DrainFailed"
+	reasonEvictionFailed = "EvictionFailed"
+)
+
+// nodeEvent records an Event on the named Kubernetes Node (if any) and on the
+// group's Lease (if stored in Leases).
+func (s *Server) nodeEvent(group, node, eventType, reason, messageFmt string, args ...any) {
+	if s.recorder == nil {
+		return
+	}
+
+	if node != "" {
+		s.recorder.Eventf(nodeReference(node), eventType, reason, messageFmt, args...)
+	}
+	if _, ok := s.store.(*LeaseStore); ok {
+		lease := &v1.ObjectReference{
+			APIVersion: "coordination.k8s.io/v1",
+			Kind:       "Lease",
+			Namespace:  s.namespace,
+			Name:       leasePrefix + group,
+		}
+		s.recorder.Eventf(lease, eventType, reason, messageFmt, args...)
+	}
+}
+
+// nodeReference returns a reference to a Node. Like the Kubelet, the UID is
+// the Node name, as `kubectl describe node` expects.
+func nodeReference(node string) *v1.ObjectReference {
+	return &v1.ObjectReference{
+		Kind: "Node",
+		Name: node,
+		UID:  types.UID(node),
+	}
+}
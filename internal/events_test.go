@@ -0,0 +1,63 @@
+package fleetlock
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestNodeEvent(t *testing.T) {
+	cases := []struct {
+		store    LockStore
+		node     string
+		expected []string
+	}{
+		// Events on the Node and Lease
+		{
+			store: NewLeaseStore(fake.NewClientset().CoordinationV1(), "default", nil),
+			node:  "node-0",
+			expected: []string{
+				"Normal RebootLockObtained Reboot lock obtained by a",
+				"Normal RebootLockObtained Reboot lock obtained by a",
+			},
+		},
+		// Events on the Node only
+		{
+			store:    NewMemoryStore(),
+			node:     "node-0",
+			expected: []string{"Normal RebootLockObtained Reboot lock obtained by a"},
+		},
+		// no Node matched
+		{
+			store:    NewMemoryStore(),
+			expected: []string{},
+		},
+	}
+
+	for _, c := range cases {
+		recorder := record.NewFakeRecorder(10)
+		s := &Server{
+			store:     c.store,
+			namespace: "default",
+			recorder:  recorder,
+		}
+		s.nodeEvent("default", c.node, v1.EventTypeNormal, reasonLockObtained, "Reboot lock obtained by %s", "a")
+		close(recorder.Events)
+
+		events := []string{}
+		for event := range recorder.Events {
+			events = append(events, event)
+		}
+		assert.Equal(t, c.expected, events)
+	}
+}
+
+func TestNodeReference(t *testing.T) {
+	ref := nodeReference("node-0")
+	assert.Equal(t, "Node", ref.Kind)
+	assert.Equal(t, "node-0", ref.Name)
+	assert.Equal(t, "node-0", string(ref.UID))
+}
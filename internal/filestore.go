@@ -0,0 +1,82 @@
+package fleetlock
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// FileStore is a LockStore which keeps RebootLocks in memory and saves them
+// to a local JSON file on each change. Changes take effect only once written
+// and synced to disk.
+type FileStore struct {
+	mapStore
+	path string
+}
+
+// NewFileStore returns a LockStore backed by a JSON file at the given path,
+// reading existing locks if the file exists.
+func NewFileStore(path string) (*FileStore, error) {
+	locks := map[string]*RebootLock{}
+
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("fleetlock: error reading lock file: %v", err)
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &locks); err != nil {
+			return nil, fmt.Errorf("fleetlock: error decoding lock file %s: %v", path, err)
+		}
+	}
+
+	store := &FileStore{
+		mapStore: mapStore{
+			locks: locks,
+		},
+		path: path,
+	}
+	store.save = store.write
+	return store, nil
+}
+
+// write atomically replaces the lock file with the given locks. Data is
+// written to a temporary file, synced, and renamed over the lock file.
+func (s *FileStore) write(locks map[string]*RebootLock) error {
+	data, err := json.MarshalIndent(locks, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(s.path)
+	tmp, err := os.CreateTemp(dir, filepath.Base(s.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return err
+	}
+
+	// sync the directory so the rename is durable
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
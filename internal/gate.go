@@ -0,0 +1,97 @@
+package fleetlock
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+)
+
+// checkNode matches a holder to a Kubernetes Node and checks the unlock gate.
+// Holders that matched no Node when locking have no Node to check.
+func (s *Server) checkNode(ctx context.Context, gate *UnlockGate, holder Holder) error {
+	if holder.Node == "" {
+		return nil
+	}
+
+	node, err := s.matchNode(ctx, holder.ID)
+	if errors.Is(err, errNodeNotMatched) {
+		// Kubelet may not have registered the Node yet
+		return deny(KindNodeNotReady, "no Kubernetes Node matches %s", holder.ID)
+	}
+	if err != nil {
+		return err
+	}
+	return s.checkUnlockGate(ctx, gate, holder, node)
+}
+
+// checkUnlockGate checks that a holder's Node is healthy after rebooting.
+// Returns a denial with a retryable reply if a check fails.
+func (s *Server) checkUnlockGate(ctx context.Context, gate *UnlockGate, holder Holder, node *v1.Node) error {
+	if gate.NodeReady && !isNodeReady(node) {
+		return deny(KindNodeNotReady, "node %s is not Ready", node.GetName())
+	}
+
+	if gate.OSChanged && !osChanged(gate, holder, node) {
+		return deny(KindNodeNotReady, "node %s OS unchanged since locking (%s, %s)", node.GetName(), holder.OSImage, holder.KernelVersion)
+	}
+
+	if gate.DaemonSetsReady {
+		pods, err := s.kubeClient.CoreV1().Pods(v1.NamespaceAll).List(ctx, metav1.ListOptions{
+			FieldSelector: fields.SelectorFromSet(fields.Set{"spec.nodeName": node.GetName()}).String(),
+		})
+		if err != nil {
+			return err
+		}
+
+		unready := unreadyDaemonSetPods(pods.Items)
+		if len(unready) > 0 {
+			return deny(KindNodeNotReady, "node %s DaemonSet pods not Ready: %s", node.GetName(), strings.Join(unready, ", "))
+		}
+	}
+	return nil
+}
+
+// osChanged returns true if a Node's OS image or kernel version differs from
+// those recorded when the hold was acquired, or if the OS image is accepted.
+// Holds which recorded no OS pass.
+func osChanged(gate *UnlockGate, holder Holder, node *v1.Node) bool {
+	info := node.Status.NodeInfo
+	if slices.Contains(gate.AcceptedOSImages, info.OSImage) {
+		return true
+	}
+	if holder.OSImage == "" && holder.KernelVersion == "" {
+		return true
+	}
+	return info.OSImage != holder.OSImage || info.KernelVersion != holder.KernelVersion
+}
+
+// unreadyDaemonSetPods returns the namespaced names of DaemonSet Pods that are
+// not Ready.
+func unreadyDaemonSetPods(pods []v1.Pod) []string {
+	unready := []string{}
+	for _, pod := range pods {
+		controller := metav1.GetControllerOf(&pod)
+		if controller == nil || controller.Kind != "DaemonSet" {
+			continue
+		}
+		if !isPodReady(&pod) {
+			unready = append(unready, pod.GetNamespace()+"/"+pod.GetName())
+		}
+	}
+	return unready
+}
+
+// isPodReady returns true if a Pod has a Ready condition that is true.
+func isPodReady(pod *v1.Pod) bool {
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == v1.PodReady {
+			return condition.Status == v1.ConditionTrue
+		}
+	}
+	return false
+}
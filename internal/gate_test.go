@@ -0,0 +1,95 @@
+package fleetlock
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestOSChanged(t *testing.T) {
+	holder := Holder{
+		ID:            "a",
+		OSImage:       "Fedora CoreOS 38.20230514.3.0",
+		KernelVersion: "6.2.15-300.fc38.x86_64",
+	}
+
+	cases := []struct {
+		name     string
+		gate     *UnlockGate
+		holder   Holder
+		info     v1.NodeSystemInfo
+		expected bool
+	}{
+		{
+			name:     "unchanged",
+			gate:     &UnlockGate{OSChanged: true},
+			holder:   holder,
+			info:     v1.NodeSystemInfo{OSImage: holder.OSImage, KernelVersion: holder.KernelVersion},
+			expected: false,
+		},
+		{
+			name:     "os-changed",
+			gate:     &UnlockGate{OSChanged: true},
+			holder:   holder,
+			info:     v1.NodeSystemInfo{OSImage: "Fedora CoreOS 38.20230609.3.0", KernelVersion: holder.KernelVersion},
+			expected: true,
+		},
+		{
+			name:     "kernel-changed",
+			gate:     &UnlockGate{OSChanged: true},
+			holder:   holder,
+			info:     v1.NodeSystemInfo{OSImage: holder.OSImage, KernelVersion: "6.3.7-200.fc38.x86_64"},
+			expected: true,
+		},
+		{
+			name:     "accepted",
+			gate:     &UnlockGate{OSChanged: true, AcceptedOSImages: []string{holder.OSImage}},
+			holder:   holder,
+			info:     v1.NodeSystemInfo{OSImage: holder.OSImage, KernelVersion: holder.KernelVersion},
+			expected: true,
+		},
+		{
+			name:     "unrecorded",
+			gate:     &UnlockGate{OSChanged: true},
+			holder:   Holder{ID: "a"},
+			info:     v1.NodeSystemInfo{OSImage: holder.OSImage, KernelVersion: holder.KernelVersion},
+			expected: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			node := &v1.Node{Status: v1.NodeStatus{NodeInfo: c.info}}
+			assert.Equal(t, c.expected, osChanged(c.gate, c.holder, node))
+		})
+	}
+}
+
+func TestUnreadyDaemonSetPods(t *testing.T) {
+	controller := true
+	pod := func(name, kind string, ready v1.ConditionStatus) v1.Pod {
+		return v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: "kube-system",
+				OwnerReferences: []metav1.OwnerReference{
+					{Kind: kind, Name: name, Controller: &controller},
+				},
+			},
+			Status: v1.PodStatus{
+				Conditions: []v1.PodCondition{
+					{Type: v1.PodReady, Status: ready},
+				},
+			},
+		}
+	}
+
+	pods := []v1.Pod{
+		pod("cilium", "DaemonSet", v1.ConditionTrue),
+		pod("kube-proxy", "DaemonSet", v1.ConditionFalse),
+		pod("coredns", "ReplicaSet", v1.ConditionFalse),
+	}
+	assert.Equal(t, []string{"kube-system/kube-proxy"}, unreadyDaemonSetPods(pods))
+}
@@ -0,0 +1,352 @@
+package fleetlock
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/yaml"
+
+	"github.com/poseidon/fleetlock/internal/drainer"
+)
+
+// Groups configures reboot groups by name.
+type Groups struct {
+	Groups map[string]*GroupConfig `json:"groups"`
+	// Node label whose value is a Node's group (optional)
+	GroupLabel string `json:"group_label"`
+	// whether to override (and log), validate, or silently ignore the
+	// client-supplied group when it differs from the Node's group label
+	// (default override)
+	GroupPolicy string `json:"group_policy"`
+}
+
+// List of policies for client-supplied groups that differ from a Node's
+// group label
+const (
+	GroupPolicyOverride = "override"
+	GroupPolicyValidate = "validate"
+	GroupPolicyIgnore   = "ignore"
+)
+
+// GroupConfig configures the reboot policy of a group.
+type GroupConfig struct {
+	// maximum number of nodes holding the reboot lease (default 1)
+	MaxConcurrency int `json:"max_concurrency"`
+	// label selector for Kubernetes Nodes in the group (default all Nodes)
+	NodeSelector string `json:"node_selector"`
+	// maximum number or percentage of unavailable group Nodes (optional)
+	MaxUnavailable *intstr.IntOrString `json:"max_unavailable"`
+	// maximum number of topology zones with Nodes rebooting at once (optional)
+	MaxZones int `json:"max_zones"`
+	// grant control plane Nodes the lock only after workers have updated, and
+	// while other control plane Nodes are Ready and not rebooting (optional)
+	ControlPlaneLast bool `json:"control_plane_last"`
+	// duration after which a reboot lease hold may be reclaimed (optional)
+	HoldTimeout metav1.Duration `json:"hold_timeout"`
+	// checks a holder's Node must pass before unlocking (optional)
+	UnlockGate UnlockGate `json:"unlock_gate"`
+	// draining of a holder's Node
+	Drain DrainConfig `json:"drain"`
+}
+
+// List of drain timeout policies
+const (
+	DrainTimeoutFail    = "fail"
+	DrainTimeoutProceed = "proceed"
+)
+
+// List of drain policies for Pods with local storage
+const (
+	DrainLocalStorageAllow  = "allow"
+	DrainLocalStorageRefuse = "refuse"
+)
+
+// List of drain policies for Pods without a controller
+const (
+	DrainUnmanagedEvict  = "evict"
+	DrainUnmanagedRefuse = "refuse"
+	DrainUnmanagedDelete = "delete"
+)
+
+// List of ways to cordon a Node
+const (
+	CordonUnschedulable = "unschedulable"
+	CordonTaint         = "taint"
+	CordonBoth          = "both"
+)
+
+// defaultTaintKey is the key of the taint added to Nodes when cordoning with
+// a taint, if none is configured.
+const defaultTaintKey = "fleetlock.poseidon/rebooting"
+
+// defaultDrainTimeout bounds waiting for a drain to complete.
+const defaultDrainTimeout = 5 * time.Minute
+
+// DrainConfig configures how a holder's Node is drained before rebooting.
+type DrainConfig struct {
+	// wait for evicted Pods to be deleted before granting the reboot lease
+	Wait bool `json:"wait"`
+	// maximum duration to wait for a drain to complete (default 5m)
+	Timeout metav1.Duration `json:"timeout"`
+	// whether to fail the lock request or proceed on timeout (default fail)
+	TimeoutPolicy string `json:"timeout_policy"`
+	// maximum concurrent Pod evictions (default 10)
+	Workers int `json:"workers"`
+	// whether to allow or refuse Pods with emptyDir volumes (default allow)
+	LocalStorage string `json:"local_storage"`
+	// whether to evict, refuse, or delete Pods without a controller (default evict)
+	UnmanagedPods string `json:"unmanaged_pods"`
+	// skip Pods matching a label selector (optional)
+	SkipSelector string `json:"skip_selector"`
+	// skip Pods in these namespaces (optional)
+	ExcludeNamespaces []string `json:"exclude_namespaces"`
+	// wait up to the duration for Job Pods to complete before evicting them
+	// (optional)
+	JobTimeout metav1.Duration `json:"job_timeout"`
+	// force delete Pods terminating longer than the duration past their grace
+	// period, while waiting (optional)
+	ForceDeleteAfter metav1.Duration `json:"force_delete_after"`
+	// wait up to the duration for the Node's VolumeAttachments to detach
+	// after draining (optional)
+	VolumeDetachTimeout metav1.Duration `json:"volume_detach_timeout"`
+	// cordon Nodes by marking them unschedulable, with a taint, or both
+	// (default unschedulable)
+	Cordon string `json:"cordon"`
+	// taint used to cordon Nodes (default fleetlock.poseidon/rebooting:NoSchedule)
+	Taint *v1.Taint `json:"taint"`
+}
+
+// WaitTimeout returns the duration to wait for a drain to complete, or zero
+// if draining is best effort.
+func (c *DrainConfig) WaitTimeout() time.Duration {
+	if !c.Wait {
+		return 0
+	}
+	if c.Timeout.Duration > 0 {
+		return c.Timeout.Duration
+	}
+	return defaultDrainTimeout
+}
+
+// Filter returns the drainer Filter of Pods to evict.
+func (c *DrainConfig) Filter() (drain.Filter, error) {
+	selector, err := labels.Parse(c.SkipSelector)
+	if err != nil {
+		return drain.Filter{}, fmt.Errorf("invalid drain skip_selector: %v", err)
+	}
+	return drain.Filter{
+		RefuseLocalStorage: c.LocalStorage == DrainLocalStorageRefuse,
+		RefuseUnmanaged:    c.UnmanagedPods == DrainUnmanagedRefuse,
+		DeleteUnmanaged:    c.UnmanagedPods == DrainUnmanagedDelete,
+		SkipSelector:       selector,
+		ExcludeNamespaces:  c.ExcludeNamespaces,
+	}, nil
+}
+
+// CordonTaint returns the taint used to cordon Nodes, or nil if Nodes are only
+// marked unschedulable.
+func (c *DrainConfig) CordonTaint() *v1.Taint {
+	if c.Cordon != CordonTaint && c.Cordon != CordonBoth {
+		return nil
+	}
+	if c.Taint != nil {
+		return c.Taint
+	}
+	return &v1.Taint{
+		Key:    defaultTaintKey,
+		Effect: v1.TaintEffectNoSchedule,
+	}
+}
+
+// UnlockGate configures checks of a holder's Node after rebooting, before
+// uncordoning the Node and releasing its reboot lease.
+type UnlockGate struct {
+	// require the Node be Ready
+	NodeReady bool `json:"node_ready"`
+	// require the Node OS image or kernel version changed since locking,
+	// unless the OS image is accepted
+	OSChanged        bool     `json:"os_changed"`
+	AcceptedOSImages []string `json:"accepted_os_images"`
+	// require DaemonSet Pods on the Node be Ready
+	DaemonSetsReady bool `json:"daemonsets_ready"`
+}
+
+// Enabled returns true if any unlock check is enabled.
+func (g *UnlockGate) Enabled() bool {
+	return g.NodeReady || g.OSChanged || g.DaemonSetsReady
+}
+
+// LoadGroups reads group configurations from a YAML or JSON file.
+func LoadGroups(path string) (*Groups, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	groups := &Groups{}
+	if err := yaml.UnmarshalStrict(data, groups); err != nil {
+		return nil, fmt.Errorf("fleetlock: error decoding groups %s: %v", path, err)
+	}
+
+	switch groups.GroupPolicy {
+	case "", GroupPolicyOverride, GroupPolicyValidate, GroupPolicyIgnore:
+	default:
+		return nil, fmt.Errorf("fleetlock: invalid group_policy %q", groups.GroupPolicy)
+	}
+	if groups.GroupPolicy != "" && groups.GroupLabel == "" {
+		return nil, fmt.Errorf("fleetlock: group_policy requires a group_label")
+	}
+
+	for name, config := range groups.Groups {
+		if name == controlPlaneGroup {
+			return nil, fmt.Errorf("fleetlock: group %s is reserved", name)
+		}
+		if config == nil {
+			groups.Groups[name] = &GroupConfig{}
+			continue
+		}
+		if err := config.validate(); err != nil {
+			return nil, fmt.Errorf("fleetlock: invalid group %s: %v", name, err)
+		}
+	}
+	return groups, nil
+}
+
+// Get returns the configuration for a group or the default configuration.
+func (g *Groups) Get(group string) *GroupConfig {
+	if g != nil {
+		if config, ok := g.Groups[group]; ok && config != nil {
+			return config
+		}
+	}
+	return &GroupConfig{}
+}
+
+// labeledGroup returns the group a Node's group label assigns, if any.
+func (g *Groups) labeledGroup(node *v1.Node) (string, bool) {
+	if g == nil || g.GroupLabel == "" || node == nil {
+		return "", false
+	}
+	group := node.GetLabels()[g.GroupLabel]
+	return group, group != ""
+}
+
+// reapable returns true if any group sets a hold timeout.
+func (g *Groups) reapable() bool {
+	if g == nil {
+		return false
+	}
+	for _, config := range g.Groups {
+		if config.HoldTimeout.Duration > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// detachesVolumes returns true if any group waits for volumes to detach.
+func (g *Groups) detachesVolumes() bool {
+	if g == nil {
+		return false
+	}
+	for _, config := range g.Groups {
+		if config.Drain.VolumeDetachTimeout.Duration > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Slots returns the number of nodes which may hold the reboot lease.
+func (c *GroupConfig) Slots() int {
+	if c.MaxConcurrency < 1 {
+		return 1
+	}
+	return c.MaxConcurrency
+}
+
+// validate checks a GroupConfig for invalid values.
+func (c *GroupConfig) validate() error {
+	if c.MaxConcurrency < 0 {
+		return fmt.Errorf("max_concurrency must not be negative")
+	}
+	if c.MaxZones < 0 {
+		return fmt.Errorf("max_zones must not be negative")
+	}
+	if c.HoldTimeout.Duration < 0 {
+		return fmt.Errorf("hold_timeout must not be negative")
+	}
+	if c.Drain.Timeout.Duration < 0 {
+		return fmt.Errorf("drain timeout must not be negative")
+	}
+	if c.Drain.VolumeDetachTimeout.Duration < 0 {
+		return fmt.Errorf("drain volume_detach_timeout must not be negative")
+	}
+	if c.Drain.ForceDeleteAfter.Duration < 0 {
+		return fmt.Errorf("drain force_delete_after must not be negative")
+	}
+	if c.Drain.JobTimeout.Duration < 0 {
+		return fmt.Errorf("drain job_timeout must not be negative")
+	}
+	if c.Drain.Workers < 0 {
+		return fmt.Errorf("drain workers must not be negative")
+	}
+	switch c.Drain.TimeoutPolicy {
+	case "", DrainTimeoutFail, DrainTimeoutProceed:
+	default:
+		return fmt.Errorf("invalid drain timeout_policy %q", c.Drain.TimeoutPolicy)
+	}
+	// only waiting drains time out or force delete Pods
+	if !c.Drain.Wait && c.Drain.TimeoutPolicy != "" {
+		return fmt.Errorf("drain timeout_policy requires drain wait")
+	}
+	if !c.Drain.Wait && c.Drain.ForceDeleteAfter.Duration > 0 {
+		return fmt.Errorf("drain force_delete_after requires drain wait")
+	}
+	switch c.Drain.Cordon {
+	case "", CordonUnschedulable, CordonTaint, CordonBoth:
+	default:
+		return fmt.Errorf("invalid drain cordon %q", c.Drain.Cordon)
+	}
+	if taint := c.Drain.Taint; taint != nil {
+		if taint.Key == "" {
+			return fmt.Errorf("drain taint requires a key")
+		}
+		switch taint.Effect {
+		case v1.TaintEffectNoSchedule, v1.TaintEffectPreferNoSchedule, v1.TaintEffectNoExecute:
+		default:
+			return fmt.Errorf("invalid drain taint effect %q", taint.Effect)
+		}
+	}
+	switch c.Drain.LocalStorage {
+	case "", DrainLocalStorageAllow, DrainLocalStorageRefuse:
+	default:
+		return fmt.Errorf("invalid drain local_storage %q", c.Drain.LocalStorage)
+	}
+	switch c.Drain.UnmanagedPods {
+	case "", DrainUnmanagedEvict, DrainUnmanagedRefuse, DrainUnmanagedDelete:
+	default:
+		return fmt.Errorf("invalid drain unmanaged_pods %q", c.Drain.UnmanagedPods)
+	}
+	if _, err := c.Drain.Filter(); err != nil {
+		return err
+	}
+	if _, err := labels.Parse(c.NodeSelector); err != nil {
+		return fmt.Errorf("invalid node_selector: %v", err)
+	}
+	if c.MaxUnavailable != nil {
+		max, err := intstr.GetScaledValueFromIntOrPercent(c.MaxUnavailable, 100, false)
+		if err != nil {
+			return fmt.Errorf("invalid max_unavailable: %v", err)
+		}
+		if max < 1 {
+			return fmt.Errorf("max_unavailable must be at least 1 or 1%%")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package fleetlock
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func TestGroupConfigValidate(t *testing.T) {
+	intOrString := func(v intstr.IntOrString) *intstr.IntOrString {
+		return &v
+	}
+
+	cases := []struct {
+		config *GroupConfig
+		valid  bool
+	}{
+		{&GroupConfig{}, true},
+		{&GroupConfig{MaxUnavailable: intOrString(intstr.FromInt(1))}, true},
+		{&GroupConfig{MaxUnavailable: intOrString(intstr.FromString("1%"))}, true},
+		// zero would block every reboot
+		{&GroupConfig{MaxUnavailable: intOrString(intstr.FromInt(0))}, false},
+		{&GroupConfig{MaxUnavailable: intOrString(intstr.FromString("0%"))}, false},
+		{&GroupConfig{MaxUnavailable: intOrString(intstr.FromInt(-1))}, false},
+		// only waiting drains time out or force delete Pods
+		{&GroupConfig{Drain: DrainConfig{Wait: true, TimeoutPolicy: DrainTimeoutProceed, ForceDeleteAfter: metav1.Duration{Duration: time.Minute}}}, true},
+		{&GroupConfig{Drain: DrainConfig{TimeoutPolicy: DrainTimeoutProceed}}, false},
+		{&GroupConfig{Drain: DrainConfig{ForceDeleteAfter: metav1.Duration{Duration: time.Minute}}}, false},
+	}
+
+	for _, c := range cases {
+		err := c.config.validate()
+		if c.valid {
+			assert.Nil(t, err)
+		} else {
+			assert.NotNil(t, err)
+		}
+	}
+}
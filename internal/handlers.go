@@ -20,6 +20,18 @@ func POSTHandler(next http.Handler) http.Handler {
 	return http.HandlerFunc(fn)
 }
 
+// GETHandler returns a handler that requires the GET method.
+func GETHandler(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet {
+			encodeReply(w, NewReply(KindMethodNotAllowed, "required method GET"))
+			return
+		}
+		next.ServeHTTP(w, req)
+	}
+	return http.HandlerFunc(fn)
+}
+
 // HeaderHandler returns a handler that requires a given header key/value.
 func HeaderHandler(key, value string, next http.Handler) http.Handler {
 	fn := func(w http.ResponseWriter, req *http.Request) {
@@ -2,9 +2,14 @@ package fleetlock
 
 import (
 	"fmt"
+	"os"
 
+	"k8s.io/api/core/v1"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedv1 "k8s.io/client-go/kubernetes/typed/core/v1"
 	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/record"
 )
 
 // newKubeClient creates a Kubernetes client using a kubeconfig at the given
@@ -19,3 +24,18 @@ func newKubeClient(kubePath string) (kubernetes.Interface, error) {
 	// create Kubernetes client
 	return kubernetes.NewForConfig(config)
 }
+
+// kubeConfigured returns true if a kubeconfig path is given or the process
+// runs in a Kubernetes Pod.
+func kubeConfigured(kubePath string) bool {
+	return kubePath != "" || os.Getenv("KUBERNETES_SERVICE_HOST") != ""
+}
+
+// newEventRecorder creates a recorder of Kubernetes Events from fleetlock.
+func newEventRecorder(client kubernetes.Interface) record.EventRecorder {
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedv1.EventSinkImpl{
+		Interface: client.CoreV1().Events(""),
+	})
+	return broadcaster.NewRecorder(scheme.Scheme, v1.EventSource{Component: "fleetlock"})
+}
@@ -2,30 +2,46 @@ package fleetlock
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"strings"
+	"time"
 
 	coordv1 "k8s.io/api/coordination/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
 	coordclient "k8s.io/client-go/kubernetes/typed/coordination/v1"
 )
 
+const (
+	// Lease annotation storing the JSON encoded reboot lease holders
+	holdersAnnotation = "fleetlock.poseidon/holders"
+	// Lease name prefix, followed by the group name
+	leasePrefix = "fleetlock-"
+)
+
+// conflictBackoff bounds retries of conflicting reboot lease updates.
+var conflictBackoff = wait.Backoff{
+	Duration: 50 * time.Millisecond,
+	Factor:   2.0,
+	Jitter:   0.5,
+	Steps:    6,
+	Cap:      1 * time.Second,
+}
+
 // RebootLease uses a Lease to hold a RebootLock.
 type RebootLease struct {
 	// name and metadata
 	Meta metav1.ObjectMeta
 	// wrapped coordination client
 	Client coordclient.LeasesGetter
+	// called on each conflicting update (optional)
+	OnConflict func()
 	// internal Lease
 	lease *coordv1.Lease
 }
 
-// RebootLock represents a node wishing to reboot.
-type RebootLock struct {
-	Holder           string
-	LeaseTransitions int32
-}
-
 // Name returns the RebootLease namespace and name.
 func (l *RebootLease) Name() string {
 	return fmt.Sprintf("%s/%s", l.Meta.Namespace, l.Meta.Name)
@@ -55,35 +71,207 @@ func (l *RebootLease) Get(ctx context.Context) (*RebootLock, error) {
 		return nil, err
 	}
 
-	// decode the LeaseSpec
-	slot := leaseSpecToRebootLock(&l.lease.Spec)
-	return slot, nil
+	// decode the Lease
+	return leaseToRebootLock(l.lease)
 }
 
 // Update tries to store the RebootLock into the the Lease.
 func (l *RebootLease) Update(ctx context.Context, slot *RebootLock) error {
+	holders, err := json.Marshal(slot.Holders)
+	if err != nil {
+		return err
+	}
+
+	if l.lease.Annotations == nil {
+		l.lease.Annotations = map[string]string{}
+	}
+	l.lease.Annotations[holdersAnnotation] = string(holders)
 	l.lease.Spec = rebootLockToLeaseSpec(slot)
-	var err error
 	l.lease, err = l.Client.Leases(l.Meta.Namespace).Update(ctx, l.lease, metav1.UpdateOptions{})
 	return err
 }
 
-// rebootLockToLeaseSpec encodes a RebootLock into a LeaseSpec.
+// LeaseStore is a LockStore which stores each group's RebootLock in a
+// Kubernetes Lease (fleetlock-<group>).
+type LeaseStore struct {
+	namespace string
+	client    coordclient.LeasesGetter
+	// called on each conflicting update (optional)
+	onConflict func(group string)
+}
+
+// NewLeaseStore returns a LockStore backed by Kubernetes Leases in the given
+// namespace.
+func NewLeaseStore(client coordclient.LeasesGetter, namespace string, onConflict func(group string)) *LeaseStore {
+	return &LeaseStore{
+		namespace:  namespace,
+		client:     client,
+		onConflict: onConflict,
+	}
+}
+
+// rebootLease returns the RebootLease for a group.
+func (s *LeaseStore) rebootLease(group string) *RebootLease {
+	return &RebootLease{
+		Meta: metav1.ObjectMeta{
+			Name:      leasePrefix + group,
+			Namespace: s.namespace,
+		},
+		Client: s.client,
+		OnConflict: func() {
+			if s.onConflict != nil {
+				s.onConflict(group)
+			}
+		},
+	}
+}
+
+// Get returns the RebootLock of a group.
+func (s *LeaseStore) Get(ctx context.Context, group string) (*RebootLock, error) {
+	return s.rebootLease(group).Get(ctx)
+}
+
+// Acquire adds a holder to a group's RebootLock, if admitted.
+func (s *LeaseStore) Acquire(ctx context.Context, group string, holder Holder, admit AdmitFunc) (*RebootLock, bool, error) {
+	acquired := false
+	lock, err := s.rebootLease(group).Modify(ctx, func(lock *RebootLock) (*RebootLock, error) {
+		update, err := acquire(lock, holder, admit)
+		acquired = update != nil
+		return update, err
+	})
+	return lock, acquired, err
+}
+
+// Release removes a holder id from a group's RebootLock, if admitted.
+func (s *LeaseStore) Release(ctx context.Context, group string, id string, admit AdmitFunc) (*RebootLock, error) {
+	return s.rebootLease(group).Modify(ctx, func(lock *RebootLock) (*RebootLock, error) {
+		return release(lock, id, admit)
+	})
+}
+
+// List returns the RebootLock of each group with a Lease.
+func (s *LeaseStore) List(ctx context.Context) (map[string]*RebootLock, error) {
+	leases, err := s.client.Leases(s.namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	locks := map[string]*RebootLock{}
+	for _, lease := range leases.Items {
+		group, ok := strings.CutPrefix(lease.GetName(), leasePrefix)
+		if !ok {
+			continue
+		}
+		lock, err := leaseToRebootLock(&lease)
+		if err != nil {
+			return nil, err
+		}
+		locks[group] = lock
+	}
+	return locks, nil
+}
+
+// Modify reads the RebootLock, passes it to the modify function, and stores
+// the returned RebootLock (if non-nil). If another writer updated the Lease in
+// the meantime, the RebootLock is re-read and modify re-evaluated, with backoff
+// bounded by the context. Returns the latest RebootLock.
+func (l *RebootLease) Modify(ctx context.Context, modify func(*RebootLock) (*RebootLock, error)) (*RebootLock, error) {
+	backoff := conflictBackoff
+	for {
+		lock, err := l.Get(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		update, err := modify(lock)
+		if err != nil || update == nil {
+			return lock, err
+		}
+
+		err = l.Update(ctx, update)
+		if err == nil {
+			return update, nil
+		}
+		if !errors.IsConflict(err) {
+			return nil, err
+		}
+
+		if l.OnConflict != nil {
+			l.OnConflict()
+		}
+		if backoff.Steps <= 1 {
+			return nil, ErrLockContention
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ErrLockContention
+		case <-time.After(backoff.Step()):
+		}
+	}
+}
+
+// rebootLockToLeaseSpec encodes a RebootLock into a LeaseSpec. Holders are
+// listed in the HolderIdentity for visibility (e.g. kubectl get leases). The
+// AcquireTime is the earliest hold, the RenewTime is the latest hold, and the
+// LeaseDurationSeconds is the longest hold duration.
 func rebootLockToLeaseSpec(slot *RebootLock) coordv1.LeaseSpec {
-	return coordv1.LeaseSpec{
-		HolderIdentity:   &slot.Holder,
+	holder := strings.Join(slot.HolderIDs(), ",")
+	spec := coordv1.LeaseSpec{
+		HolderIdentity:   &holder,
 		LeaseTransitions: &slot.LeaseTransitions,
 	}
+
+	var duration time.Duration
+	for _, holder := range slot.Holders {
+		acquired := metav1.NewMicroTime(holder.AcquireTime)
+		if spec.AcquireTime == nil || acquired.Before(spec.AcquireTime) {
+			spec.AcquireTime = &acquired
+		}
+		if spec.RenewTime == nil || spec.RenewTime.Before(&acquired) {
+			spec.RenewTime = &acquired
+		}
+		duration = max(duration, holder.Duration.Duration)
+	}
+
+	if duration > 0 {
+		seconds := int32(duration.Seconds())
+		spec.LeaseDurationSeconds = &seconds
+	}
+	return spec
 }
 
-// leaseSpecToRebootLock decodes a LeaseSpec to a RebootLock
-func leaseSpecToRebootLock(spec *coordv1.LeaseSpec) *RebootLock {
-	slot := &RebootLock{}
-	if spec.HolderIdentity != nil {
-		slot.Holder = *spec.HolderIdentity
+// leaseToRebootLock decodes a Lease to a RebootLock. Leases written before
+// multiple holders were supported have a single HolderIdentity.
+func leaseToRebootLock(lease *coordv1.Lease) (*RebootLock, error) {
+	slot := &RebootLock{
+		Holders: []Holder{},
 	}
+	spec := lease.Spec
 	if spec.LeaseTransitions != nil {
 		slot.LeaseTransitions = *spec.LeaseTransitions
 	}
-	return slot
+
+	if holders, ok := lease.Annotations[holdersAnnotation]; ok {
+		if err := json.Unmarshal([]byte(holders), &slot.Holders); err != nil {
+			return nil, fmt.Errorf("fleetlock: error decoding lease holders: %v", err)
+		}
+		return slot, nil
+	}
+
+	// migrate single holder Lease, which may predate setting an AcquireTime
+	if spec.HolderIdentity != nil && *spec.HolderIdentity != "" {
+		holder := Holder{
+			ID:          *spec.HolderIdentity,
+			AcquireTime: lease.CreationTimestamp.Time,
+		}
+		if spec.AcquireTime != nil {
+			holder.AcquireTime = spec.AcquireTime.Time
+		}
+		if spec.LeaseDurationSeconds != nil {
+			holder.Duration.Duration = time.Duration(*spec.LeaseDurationSeconds) * time.Second
+		}
+		slot.Holders = append(slot.Holders, holder)
+	}
+	return slot, nil
 }
@@ -0,0 +1,174 @@
+package fleetlock
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	coordv1 "k8s.io/api/coordination/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestLeaseToRebootLock(t *testing.T) {
+	holder := "e0f3745b108f471cbd4883c6fbed8cdd"
+	empty := ""
+	transitions := int32(3)
+	acquired := metav1.NewMicroTime(time.Date(2022, 1, 2, 3, 4, 5, 0, time.UTC))
+
+	cases := []struct {
+		name     string
+		lease    *coordv1.Lease
+		expected *RebootLock
+	}{
+		{
+			name:  "empty",
+			lease: &coordv1.Lease{},
+			expected: &RebootLock{
+				Holders: []Holder{},
+			},
+		},
+		{
+			name: "unlocked",
+			lease: &coordv1.Lease{
+				Spec: coordv1.LeaseSpec{
+					HolderIdentity:   &empty,
+					LeaseTransitions: &transitions,
+				},
+			},
+			expected: &RebootLock{
+				Holders:          []Holder{},
+				LeaseTransitions: 3,
+			},
+		},
+		// migrate single holder Leases
+		{
+			name: "single-holder",
+			lease: &coordv1.Lease{
+				Spec: coordv1.LeaseSpec{
+					HolderIdentity:   &holder,
+					AcquireTime:      &acquired,
+					LeaseTransitions: &transitions,
+				},
+			},
+			expected: &RebootLock{
+				Holders: []Holder{
+					{ID: holder, AcquireTime: acquired.Time},
+				},
+				LeaseTransitions: 3,
+			},
+		},
+		{
+			name: "multiple-holders",
+			lease: &coordv1.Lease{
+				ObjectMeta: metav1.ObjectMeta{
+					Annotations: map[string]string{
+						holdersAnnotation: `[{"id":"a","acquireTime":"2022-01-02T03:04:05Z"},{"id":"b","acquireTime":"2022-01-02T03:04:06Z"}]`,
+					},
+				},
+				Spec: coordv1.LeaseSpec{
+					HolderIdentity:   &holder,
+					LeaseTransitions: &transitions,
+				},
+			},
+			expected: &RebootLock{
+				Holders: []Holder{
+					{ID: "a", AcquireTime: acquired.Time},
+					{ID: "b", AcquireTime: acquired.Time.Add(time.Second)},
+				},
+				LeaseTransitions: 3,
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			actual, err := leaseToRebootLock(c.lease)
+			assert.Nil(t, err)
+			assert.Equal(t, c.expected, actual)
+		})
+	}
+}
+
+func TestRebootLockToLeaseSpec(t *testing.T) {
+	now := time.Date(2022, 1, 2, 3, 4, 5, 0, time.UTC)
+	timeout := metav1.Duration{Duration: 30 * time.Minute}
+	lock := &RebootLock{Holders: []Holder{}}
+	lock = lock.Acquire(Holder{ID: "a", AcquireTime: now.Add(-2 * time.Hour), Duration: timeout})
+	lock = lock.Acquire(Holder{ID: "b", AcquireTime: now.Add(-10 * time.Minute), Duration: timeout})
+
+	spec := rebootLockToLeaseSpec(lock)
+	assert.Equal(t, "a,b", *spec.HolderIdentity)
+	assert.Equal(t, int32(2), *spec.LeaseTransitions)
+	assert.Equal(t, now.Add(-2*time.Hour), spec.AcquireTime.Time)
+	assert.Equal(t, now.Add(-10*time.Minute), spec.RenewTime.Time)
+	assert.Equal(t, int32(1800), *spec.LeaseDurationSeconds)
+
+	// unlocked lease has no times
+	spec = rebootLockToLeaseSpec(lock.Release("a").Release("b"))
+	assert.Equal(t, "", *spec.HolderIdentity)
+	assert.Nil(t, spec.AcquireTime)
+	assert.Nil(t, spec.RenewTime)
+	assert.Nil(t, spec.LeaseDurationSeconds)
+}
+
+// newTestRebootLease returns a RebootLease whose first conflicts updates fail
+// with a conflict error.
+func newTestRebootLease(conflicts int) (*RebootLease, *int) {
+	client := fake.NewClientset()
+	attempts := 0
+	client.PrependReactor("update", "leases", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		attempts++
+		if attempts <= conflicts {
+			return true, nil, errors.NewConflict(schema.GroupResource{Resource: "leases"}, "fleetlock-default", nil)
+		}
+		return false, nil, nil
+	})
+
+	seen := 0
+	return &RebootLease{
+		Meta: metav1.ObjectMeta{
+			Name:      "fleetlock-default",
+			Namespace: "default",
+		},
+		Client: client.CoordinationV1(),
+		OnConflict: func() {
+			seen++
+		},
+	}, &seen
+}
+
+func TestRebootLeaseModify(t *testing.T) {
+	acquire := func(lock *RebootLock) (*RebootLock, error) {
+		return lock.Acquire(Holder{ID: "a", AcquireTime: time.Now()}), nil
+	}
+
+	// conflicting updates are retried
+	rebootLease, conflicts := newTestRebootLease(2)
+	lock, err := rebootLease.Modify(context.Background(), acquire)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a"}, lock.HolderIDs())
+	assert.Equal(t, 2, *conflicts)
+
+	lock, err = rebootLease.Get(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a"}, lock.HolderIDs())
+
+	// persistent conflicts report contention
+	rebootLease, conflicts = newTestRebootLease(100)
+	_, err = rebootLease.Modify(context.Background(), acquire)
+	assert.Equal(t, ErrLockContention, err)
+	assert.Equal(t, conflictBackoff.Steps, *conflicts)
+
+	// retries are bounded by the context
+	rebootLease, _ = newTestRebootLease(100)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = rebootLease.Modify(ctx, acquire)
+	assert.Equal(t, ErrLockContention, err)
+}
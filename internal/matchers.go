@@ -0,0 +1,65 @@
+package fleetlock
+
+import (
+	"fmt"
+
+	"k8s.io/api/core/v1"
+)
+
+// List of strategies for matching Zincati requests to Kubernetes Nodes
+const (
+	// Zincati ID derived from the Node MachineID
+	MatchMachineID = "machine-id"
+	// Zincati ID derived from the Node SystemUUID
+	MatchSystemUUID = "system-uuid"
+	// Zincati ID set in a Node annotation or label
+	MatchAnnotation = "annotation"
+)
+
+// DefaultMatchers is the default chain of Node matching strategies.
+var DefaultMatchers = []string{MatchMachineID, MatchSystemUUID, MatchAnnotation}
+
+// ZincatiIDAnnotation is a Node annotation (or label) set to the Node's
+// Zincati ID, for Nodes whose Kubelet can't read /etc/machine-id (e.g. set by
+// a provisioning snippet).
+const ZincatiIDAnnotation = "fleetlock.poseidon/zincati-id"
+
+// validateMatchers checks a chain of Node matching strategies.
+func validateMatchers(matchers []string) error {
+	if len(matchers) == 0 {
+		return fmt.Errorf("fleetlock: node matchers must not be empty")
+	}
+	for _, matcher := range matchers {
+		switch matcher {
+		case MatchMachineID, MatchSystemUUID, MatchAnnotation:
+		default:
+			return fmt.Errorf("fleetlock: unknown node matcher %q", matcher)
+		}
+	}
+	return nil
+}
+
+// nodeZincatiID returns a Node's Zincati ID according to a matching strategy,
+// computing IDs from systemd IDs with the given function.
+func nodeZincatiID(node *v1.Node, strategy string, zincatiID func(string) (string, error)) (string, bool) {
+	var id string
+	var err error
+	switch strategy {
+	case MatchMachineID, MatchSystemUUID:
+		systemdID := node.Status.NodeInfo.MachineID
+		if strategy == MatchSystemUUID {
+			systemdID = node.Status.NodeInfo.SystemUUID
+		}
+		// unreported IDs would all hash to the same Zincati ID
+		if systemdID == "" {
+			return "", false
+		}
+		id, err = zincatiID(systemdID)
+	case MatchAnnotation:
+		id = node.GetAnnotations()[ZincatiIDAnnotation]
+		if id == "" {
+			id = node.GetLabels()[ZincatiIDAnnotation]
+		}
+	}
+	return id, err == nil && id != ""
+}
@@ -0,0 +1,99 @@
+package fleetlock
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestNodeZincatiID(t *testing.T) {
+	machineID := "dfd7882acda64c34aca76193c46f5d4e"
+	systemUUID := "26A8B2D5-60A6-4A4C-9C8A-6C4D2E1F0B3A"
+	expectedMachine, _ := ZincatiID(machineID)
+	expectedUUID, _ := ZincatiID(systemUUID)
+
+	node := &v1.Node{
+		Status: v1.NodeStatus{
+			NodeInfo: v1.NodeSystemInfo{
+				MachineID:  machineID,
+				SystemUUID: systemUUID,
+			},
+		},
+	}
+	annotated := &v1.Node{}
+	annotated.Annotations = map[string]string{ZincatiIDAnnotation: "a"}
+	labeled := &v1.Node{}
+	labeled.Labels = map[string]string{ZincatiIDAnnotation: "b"}
+
+	cases := []struct {
+		node     *v1.Node
+		strategy string
+		id       string
+		ok       bool
+	}{
+		{node, MatchMachineID, expectedMachine, true},
+		{node, MatchSystemUUID, expectedUUID, true},
+		{node, MatchAnnotation, "", false},
+		{annotated, MatchMachineID, "", false},
+		{annotated, MatchSystemUUID, "", false},
+		{annotated, MatchAnnotation, "a", true},
+		{labeled, MatchAnnotation, "b", true},
+	}
+	for _, c := range cases {
+		id, ok := nodeZincatiID(c.node, c.strategy, ZincatiID)
+		assert.Equal(t, c.ok, ok)
+		assert.Equal(t, c.id, id)
+	}
+}
+
+func TestValidateMatchers(t *testing.T) {
+	assert.Nil(t, validateMatchers(DefaultMatchers))
+	assert.Nil(t, validateMatchers([]string{MatchAnnotation}))
+	assert.NotNil(t, validateMatchers([]string{}))
+	assert.NotNil(t, validateMatchers([]string{"hostname"}))
+}
+
+func TestMatchNodeChain(t *testing.T) {
+	ctx := context.Background()
+	// node-0 is matched by MachineID, node-1 by SystemUUID, node-2 by annotation
+	node0, node1, node2 := testNode(0), testNode(1), testNode(2)
+	node1.Status.NodeInfo.SystemUUID = node1.Status.NodeInfo.MachineID
+	node1.Status.NodeInfo.MachineID = ""
+	node2.Status.NodeInfo.MachineID = ""
+	node2.Annotations = map[string]string{ZincatiIDAnnotation: "provisioned-id"}
+	id0, _ := ZincatiID(node0.Status.NodeInfo.MachineID)
+	id1, _ := ZincatiID(node1.Status.NodeInfo.SystemUUID)
+
+	cases := []struct {
+		matchers []string
+		id       string
+		node     string
+		strategy string
+	}{
+		{DefaultMatchers, id0, "node-0", MatchMachineID},
+		{DefaultMatchers, id1, "node-1", MatchSystemUUID},
+		{DefaultMatchers, "provisioned-id", "node-2", MatchAnnotation},
+		{[]string{MatchMachineID}, id1, "", ""},
+		{[]string{MatchAnnotation}, "provisioned-id", "node-2", MatchAnnotation},
+	}
+	for _, c := range cases {
+		s := &Server{
+			log:        logrus.New(),
+			metrics:    newMetrics(),
+			kubeClient: fake.NewClientset(&node0, &node1, &node2),
+			matchers:   c.matchers,
+		}
+		node, strategy, err := s.findNode(ctx, c.id)
+		assert.Nil(t, err)
+		assert.Equal(t, c.strategy, strategy)
+		if c.node == "" {
+			assert.Nil(t, node)
+		} else {
+			assert.Equal(t, c.node, node.GetName())
+		}
+	}
+}
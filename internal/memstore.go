@@ -0,0 +1,112 @@
+package fleetlock
+
+import (
+	"context"
+	"sync"
+)
+
+// MemoryStore is a LockStore which keeps RebootLocks in memory. Locks are lost
+// when the process exits.
+type MemoryStore struct {
+	mapStore
+}
+
+// NewMemoryStore returns a LockStore backed by memory.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		mapStore: mapStore{
+			locks: map[string]*RebootLock{},
+		},
+	}
+}
+
+// mapStore keeps RebootLocks in a map and optionally saves each change.
+type mapStore struct {
+	mu    sync.Mutex
+	locks map[string]*RebootLock
+	// save persists locks before changes take effect (optional)
+	save func(locks map[string]*RebootLock) error
+}
+
+// Get returns the RebootLock of a group.
+func (s *mapStore) Get(ctx context.Context, group string) (*RebootLock, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.get(group), nil
+}
+
+// Acquire adds a holder to a group's RebootLock, if admitted.
+func (s *mapStore) Acquire(ctx context.Context, group string, holder Holder, admit AdmitFunc) (*RebootLock, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	lock := s.get(group)
+	update, err := acquire(lock, holder, admit)
+	if err != nil || update == nil {
+		return lock, false, err
+	}
+	if err := s.put(group, update); err != nil {
+		return nil, false, err
+	}
+	return s.get(group), true, nil
+}
+
+// Release removes a holder id from a group's RebootLock, if admitted.
+func (s *mapStore) Release(ctx context.Context, group string, id string, admit AdmitFunc) (*RebootLock, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	lock := s.get(group)
+	update, err := release(lock, id, admit)
+	if err != nil || update == nil {
+		return lock, err
+	}
+	if err := s.put(group, update); err != nil {
+		return nil, err
+	}
+	return s.get(group), nil
+}
+
+// List returns the RebootLock of each group.
+func (s *mapStore) List(ctx context.Context) (map[string]*RebootLock, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	locks := map[string]*RebootLock{}
+	for group := range s.locks {
+		locks[group] = s.get(group)
+	}
+	return locks, nil
+}
+
+// get returns a copy of a group's RebootLock. Callers must hold the mutex.
+func (s *mapStore) get(group string) *RebootLock {
+	lock, ok := s.locks[group]
+	if !ok {
+		return &RebootLock{Holders: []Holder{}}
+	}
+	holders := make([]Holder, len(lock.Holders))
+	copy(holders, lock.Holders)
+	return &RebootLock{
+		Holders:          holders,
+		LeaseTransitions: lock.LeaseTransitions,
+	}
+}
+
+// put sets a group's RebootLock, saving the change first (if required).
+// Callers must hold the mutex.
+func (s *mapStore) put(group string, lock *RebootLock) error {
+	locks := make(map[string]*RebootLock, len(s.locks)+1)
+	for name, existing := range s.locks {
+		locks[name] = existing
+	}
+	locks[group] = lock
+
+	if s.save != nil {
+		if err := s.save(locks); err != nil {
+			return err
+		}
+	}
+	s.locks = locks
+	return nil
+}
@@ -8,6 +8,10 @@ import (
 type metrics struct {
 	lockState       *prometheus.GaugeVec
 	lockTransitions *prometheus.GaugeVec
+	lockReclaims    *prometheus.CounterVec
+	lockConflicts   *prometheus.CounterVec
+	podForceDeletes *prometheus.CounterVec
+	nodeMatches     *prometheus.CounterVec
 	lockRequests    prometheus.Counter
 	unlockRequests  prometheus.Counter
 }
@@ -24,6 +28,26 @@ func newMetrics() *metrics {
 		Help: "Number of fleetlock lease transitions",
 	}, []string{"group"})
 
+	lockReclaims := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "fleetlock_lock_reclaim_count",
+		Help: "Number of expired fleetlock lease holds reclaimed",
+	}, []string{"group"})
+
+	lockConflicts := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "fleetlock_lock_conflict_count",
+		Help: "Number of conflicting fleetlock lease updates",
+	}, []string{"group"})
+
+	podForceDeletes := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "fleetlock_pod_force_delete_count",
+		Help: "Number of Pods force deleted after terminating past their grace period",
+	}, []string{"group"})
+
+	nodeMatches := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "fleetlock_node_match_count",
+		Help: "Number of Zincati requests matched to Nodes by matching strategy (none if unmatched)",
+	}, []string{"strategy"})
+
 	lockRequests := prometheus.NewCounter(prometheus.CounterOpts{
 		Name: "fleetlock_lock_request_count",
 		Help: "Number of lock requests",
@@ -37,6 +61,10 @@ func newMetrics() *metrics {
 	return &metrics{
 		lockState:       lockState,
 		lockTransitions: lockTransitions,
+		lockReclaims:    lockReclaims,
+		lockConflicts:   lockConflicts,
+		podForceDeletes: podForceDeletes,
+		nodeMatches:     nodeMatches,
 		lockRequests:    lockRequests,
 		unlockRequests:  unlockRequests,
 	}
@@ -47,6 +75,10 @@ func (m *metrics) Register(registry prometheus.Registerer) error {
 	collectors := []prometheus.Collector{
 		m.lockState,
 		m.lockTransitions,
+		m.lockReclaims,
+		m.lockConflicts,
+		m.podForceDeletes,
+		m.nodeMatches,
 		m.lockRequests,
 		m.unlockRequests,
 	}
@@ -0,0 +1,205 @@
+package fleetlock
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	listersv1 "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// nodeCache caches Kubernetes Nodes via a shared informer, indexed by the
+// Zincati ID of each Node matching strategy.
+type nodeCache struct {
+	factory  informers.SharedInformerFactory
+	informer cache.SharedIndexInformer
+	lister   listersv1.NodeLister
+
+	// Zincati IDs memoized by systemd ID (e.g. MachineID)
+	mu  sync.Mutex
+	ids map[string]string
+}
+
+// newNodeCache returns a Node cache, which must be started with Run.
+func newNodeCache(client kubernetes.Interface) (*nodeCache, error) {
+	factory := informers.NewSharedInformerFactory(client, 0)
+	nodes := factory.Core().V1().Nodes()
+
+	c := &nodeCache{
+		factory:  factory,
+		informer: nodes.Informer(),
+		lister:   nodes.Lister(),
+		ids:      map[string]string{},
+	}
+
+	// drop large fields fleetlock doesn't use
+	err := c.informer.SetTransform(func(obj any) (any, error) {
+		if node, ok := obj.(*v1.Node); ok {
+			node.ManagedFields = nil
+			node.Status.Images = nil
+		}
+		return obj, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// forget the Zincati IDs of deleted Nodes and replaced systemd IDs
+	_, err = c.informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		UpdateFunc: func(oldObj, newObj any) {
+			c.forget(oldObj, newObj)
+		},
+		DeleteFunc: func(obj any) {
+			c.forget(obj, nil)
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	indexers := cache.Indexers{}
+	for _, strategy := range DefaultMatchers {
+		indexers[strategy] = c.indexZincatiID(strategy)
+	}
+	err = c.informer.AddIndexers(indexers)
+	return c, err
+}
+
+// Run starts watching Nodes until the context is done.
+func (c *nodeCache) Run(ctx context.Context) {
+	c.factory.Start(ctx.Done())
+}
+
+// Synced returns true once the cache has listed all Nodes.
+func (c *nodeCache) Synced() bool {
+	return c.informer.HasSynced()
+}
+
+// ByZincatiID returns the cached Nodes with the given Zincati ID according to
+// a matching strategy.
+func (c *nodeCache) ByZincatiID(strategy, id string) ([]*v1.Node, error) {
+	objs, err := c.informer.GetIndexer().ByIndex(strategy, id)
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := make([]*v1.Node, 0, len(objs))
+	for _, obj := range objs {
+		if node, ok := obj.(*v1.Node); ok {
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes, nil
+}
+
+// List returns the cached Nodes matching a label selector.
+func (c *nodeCache) List(selector labels.Selector) ([]*v1.Node, error) {
+	return c.lister.List(selector)
+}
+
+// indexZincatiID returns an index function of Node Zincati IDs according to
+// a matching strategy. Nodes without an ID aren't indexed.
+func (c *nodeCache) indexZincatiID(strategy string) cache.IndexFunc {
+	return func(obj any) ([]string, error) {
+		node, ok := obj.(*v1.Node)
+		if !ok {
+			return nil, nil
+		}
+
+		if id, ok := nodeZincatiID(node, strategy, c.zincatiID); ok {
+			return []string{id}, nil
+		}
+		return nil, nil
+	}
+}
+
+// zincatiID returns the Zincati ID of a systemd ID (e.g. MachineID), computed
+// only once per systemd ID.
+func (c *nodeCache) zincatiID(systemdID string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if id, ok := c.ids[systemdID]; ok {
+		return id, nil
+	}
+
+	id, err := ZincatiID(systemdID)
+	if err != nil {
+		return "", err
+	}
+	c.ids[systemdID] = id
+	return id, nil
+}
+
+// forget drops the memoized Zincati IDs of an old Node's systemd IDs, unless
+// the current Node (if any) still reports them.
+func (c *nodeCache) forget(oldObj, obj any) {
+	if tombstone, ok := oldObj.(cache.DeletedFinalStateUnknown); ok {
+		oldObj = tombstone.Obj
+	}
+	old, ok := oldObj.(*v1.Node)
+	if !ok {
+		return
+	}
+	current := map[string]bool{}
+	if node, ok := obj.(*v1.Node); ok {
+		current[node.Status.NodeInfo.MachineID] = true
+		current[node.Status.NodeInfo.SystemUUID] = true
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, systemdID := range []string{old.Status.NodeInfo.MachineID, old.Status.NodeInfo.SystemUUID} {
+		if !current[systemdID] {
+			delete(c.ids, systemdID)
+		}
+	}
+}
+
+// listNodes lists Kubernetes Nodes matching a label selector, from the Node
+// cache once synced or from the API server.
+func (s *Server) listNodes(ctx context.Context, selector string) ([]v1.Node, error) {
+	if s.nodes != nil && s.nodes.Synced() {
+		sel, err := labels.Parse(selector)
+		if err != nil {
+			return nil, err
+		}
+
+		cached, err := s.nodes.List(sel)
+		if err != nil {
+			return nil, err
+		}
+		nodes := make([]v1.Node, 0, len(cached))
+		for _, node := range cached {
+			nodes = append(nodes, *node.DeepCopy())
+		}
+		return nodes, nil
+	}
+
+	nodes, err := s.kubeClient.CoreV1().Nodes().List(ctx, metav1.ListOptions{
+		LabelSelector: selector,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return nodes.Items, nil
+}
+
+// readyHandler handles readiness checks with an ok status response once the
+// Node cache (if any) is synced.
+func (s *Server) readyHandler() http.Handler {
+	fn := func(w http.ResponseWriter, req *http.Request) {
+		if s.nodes != nil && !s.nodes.Synced() {
+			http.Error(w, "node cache not synced", http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintf(w, "ok")
+	}
+	return http.HandlerFunc(fn)
+}
@@ -0,0 +1,87 @@
+package fleetlock
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestNodeCache(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	node0, node1 := testNode(0), testNode(1)
+	node1.Labels = map[string]string{"role": "worker"}
+	client := fake.NewClientset(&node0, &node1)
+
+	c, err := newNodeCache(client)
+	require.Nil(t, err)
+	c.Run(ctx)
+	require.Eventually(t, c.Synced, 5*time.Second, 10*time.Millisecond)
+
+	// Nodes are indexed by Zincati ID
+	id, _ := ZincatiID(node1.Status.NodeInfo.MachineID)
+	nodes, err := c.ByZincatiID(MatchMachineID, id)
+	assert.Nil(t, err)
+	assert.Len(t, nodes, 1)
+	assert.Equal(t, "node-1", nodes[0].GetName())
+
+	nodes, err = c.List(labels.SelectorFromSet(labels.Set{"role": "worker"}))
+	assert.Nil(t, err)
+	assert.Len(t, nodes, 1)
+
+	// index follows MachineID changes
+	updated := testNode(2)
+	updated.Name = "node-1"
+	_, err = client.CoreV1().Nodes().Update(ctx, &updated, metav1.UpdateOptions{})
+	require.Nil(t, err)
+	newID, _ := ZincatiID(updated.Status.NodeInfo.MachineID)
+	assert.Eventually(t, func() bool {
+		nodes, err := c.ByZincatiID(MatchMachineID, newID)
+		return err == nil && len(nodes) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	nodes, err = c.ByZincatiID(MatchMachineID, id)
+	assert.Nil(t, err)
+	assert.Empty(t, nodes)
+
+	// Zincati IDs are computed once per MachineID, and forgotten once replaced
+	idCount := func() int {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return len(c.ids)
+	}
+	assert.Eventually(t, func() bool { return idCount() == 2 }, 5*time.Second, 10*time.Millisecond)
+
+	// or deleted
+	err = client.CoreV1().Nodes().Delete(ctx, "node-1", metav1.DeleteOptions{})
+	require.Nil(t, err)
+	assert.Eventually(t, func() bool { return idCount() == 1 }, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestReadyHandler(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	node := testNode(0)
+	c, err := newNodeCache(fake.NewClientset(&node))
+	require.Nil(t, err)
+	s := &Server{nodes: c}
+
+	// not ready until the Node cache syncs
+	w := httptest.NewRecorder()
+	s.readyHandler().ServeHTTP(w, httptest.NewRequest("GET", "/-/ready", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+
+	c.Run(ctx)
+	require.Eventually(t, c.Synced, 5*time.Second, 10*time.Millisecond)
+	w = httptest.NewRecorder()
+	s.readyHandler().ServeHTTP(w, httptest.NewRequest("GET", "/-/ready", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "ok", w.Body.String())
+}
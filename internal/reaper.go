@@ -0,0 +1,166 @@
+package fleetlock
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+	"k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// interval between checks for expired reboot lease holds
+	reapInterval = 1 * time.Minute
+)
+
+// errHoldChanged indicates a hold changed since it was found to be expired.
+var errHoldChanged = errors.New("fleetlock: reboot lease hold changed")
+
+// reap periodically reclaims expired reboot lease holds until the context is
+// done.
+func (s *Server) reap(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for group, config := range s.groups.Groups {
+				if config.HoldTimeout.Duration > 0 {
+					s.reapGroup(ctx, group, config)
+				}
+			}
+		}
+	}
+}
+
+// reapGroup releases a group's reboot lease holds that are older than the hold
+// timeout, but only if the matching Node has rebooted and returned to Ready
+// (and is then uncordoned) or has been deleted. Holds of Nodes that remain
+// NotReady or haven't rebooted are kept for an admin to investigate.
+func (s *Server) reapGroup(ctx context.Context, group string, config *GroupConfig) {
+	lock, err := s.store.Get(ctx, group)
+	if err != nil {
+		s.log.WithField("group", group).Errorf("fleetlock: error getting reboot lease: %v", err)
+		return
+	}
+
+	for _, holder := range lock.Expired(config.HoldTimeout.Duration, time.Now()) {
+		fields := logrus.Fields{
+			"id":    holder.ID,
+			"group": group,
+			"age":   time.Since(holder.AcquireTime).Round(time.Second).String(),
+		}
+
+		node, err := s.matchNode(ctx, holder.ID)
+		switch {
+		case errors.Is(err, errNodeNotMatched):
+			// an unmatched Node may still exist (e.g. an unreported MachineID)
+			deleted, err := s.nodeDeleted(ctx, holder)
+			if err != nil {
+				s.log.WithFields(fields).Errorf("fleetlock: error getting expired holder's node: %v", err)
+				continue
+			}
+			if !deleted {
+				s.log.WithFields(fields).Info("fleetlock: expired holder matches no node, but wasn't deleted, keep reboot lease")
+				continue
+			}
+			fields["node"] = holder.Node
+			fields["reason"] = "deleted"
+		case err != nil:
+			s.log.WithFields(fields).Errorf("fleetlock: error matching expired holder: %v", err)
+			continue
+		case isNodeReady(node) && rebooted(node, holder):
+			fields["node"] = node.GetName()
+			fields["reason"] = "ready"
+		case isNodeReady(node):
+			fields["node"] = node.GetName()
+			s.log.WithFields(fields).Info("fleetlock: expired holder's node hasn't rebooted, keep reboot lease")
+			continue
+		default:
+			fields["node"] = node.GetName()
+			s.log.WithFields(fields).Info("fleetlock: expired holder's node is not ready, keep reboot lease")
+			continue
+		}
+
+		// release only the expired hold, not a hold the node re-acquired since
+		lock, err = s.store.Release(ctx, group, holder.ID, unchangedHold(holder))
+		if errors.Is(err, errHoldChanged) {
+			s.log.WithFields(fields).Info("fleetlock: expired holder re-acquired reboot lease, keep reboot lease")
+			continue
+		}
+		if err != nil {
+			s.log.WithFields(fields).Errorf("fleetlock: error reclaiming reboot lease: %v", err)
+			return
+		}
+
+		if config.ControlPlaneLast {
+			s.releaseControlPlane(ctx, holder.ID)
+		}
+
+		s.metrics.lockState.With(prometheus.Labels{"group": group}).Set(lockState(lock))
+		s.metrics.lockReclaims.With(prometheus.Labels{"group": group}).Inc()
+		s.log.WithFields(fields).Info("fleetlock: reclaimed expired reboot lease")
+
+		// finish the rebooted Node's reboot, as unlock would
+		if node != nil {
+			s.finishReboot(ctx, group, config, node.GetName(), fields)
+		}
+	}
+}
+
+// rebooted returns true if a Node rebooted since its hold was acquired, by
+// its boot ID or, for holds without one, its OS image or kernel version.
+func rebooted(node *v1.Node, holder Holder) bool {
+	info := node.Status.NodeInfo
+	if holder.BootID != "" {
+		return info.BootID != holder.BootID
+	}
+	return (holder.OSImage != "" && info.OSImage != holder.OSImage) ||
+		(holder.KernelVersion != "" && info.KernelVersion != holder.KernelVersion)
+}
+
+// finishReboot uncordons a Node whose hold was reclaimed and clears its reboot
+// phase. Errors are logged, since the hold is already released.
+func (s *Server) finishReboot(ctx context.Context, group string, config *GroupConfig, node string, fields logrus.Fields) {
+	drainer, err := s.newDrainer(group, &config.Drain)
+	if err == nil {
+		err = drainer.Uncordon(ctx, node)
+	}
+	if err != nil {
+		s.log.WithFields(fields).Errorf("fleetlock: error uncordoning reclaimed node: %v", err)
+	}
+	s.setRebootPhase(ctx, group, node, PhaseDone)
+}
+
+// nodeDeleted returns true if the Node recorded by a holder no longer exists.
+// Holders without a recorded Node can't be known to be deleted.
+func (s *Server) nodeDeleted(ctx context.Context, holder Holder) (bool, error) {
+	if holder.Node == "" {
+		return false, nil
+	}
+
+	_, err := s.kubeClient.CoreV1().Nodes().Get(ctx, holder.Node, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return true, nil
+	}
+	return false, err
+}
+
+// unchangedHold admits releasing a holder only if its hold was acquired at the
+// same time as the given hold.
+func unchangedHold(holder Holder) AdmitFunc {
+	return func(lock *RebootLock) error {
+		current, ok := lock.Holder(holder.ID)
+		if !ok || !current.AcquireTime.Equal(holder.AcquireTime) {
+			return errHoldChanged
+		}
+		return nil
+	}
+}
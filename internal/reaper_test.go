@@ -0,0 +1,70 @@
+package fleetlock
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestReapGroup(t *testing.T) {
+	ctx := context.Background()
+	// node-0 is Ready and rebooted, node-1 is NotReady, node-2 doesn't report
+	// a MachineID
+	node0, node1, node2 := testNode(0), testNode(1), testNode(2)
+	node0.Status.NodeInfo.BootID = "boot-1"
+	node1.Status.Conditions[0].Status = v1.ConditionFalse
+	node2.Status.NodeInfo.MachineID = ""
+	id0, _ := ZincatiID(node0.Status.NodeInfo.MachineID)
+	id1, _ := ZincatiID(node1.Status.NodeInfo.MachineID)
+	config := &GroupConfig{HoldTimeout: metav1.Duration{Duration: time.Hour}}
+	expired := time.Now().Add(-2 * time.Hour)
+
+	cases := []struct {
+		name    string
+		holder  Holder
+		reclaim bool
+	}{
+		{"ready", Holder{ID: id0, Node: "node-0", BootID: "boot-0", AcquireTime: expired}, true},
+		{"not-rebooted", Holder{ID: id0, Node: "node-0", BootID: "boot-1", AcquireTime: expired}, false},
+		{"unrecorded-boot", Holder{ID: id0, Node: "node-0", AcquireTime: expired}, false},
+		{"not-ready", Holder{ID: id1, Node: "node-1", AcquireTime: expired}, false},
+		{"unmatched", Holder{ID: "a", Node: "node-2", AcquireTime: expired}, false},
+		{"unrecorded", Holder{ID: "a", AcquireTime: expired}, false},
+		{"deleted", Holder{ID: "a", Node: "node-3", AcquireTime: expired}, true},
+		{"unexpired", Holder{ID: id0, Node: "node-0", BootID: "boot-0", AcquireTime: time.Now()}, false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			s := &Server{
+				log:        logrus.New(),
+				metrics:    newMetrics(),
+				store:      NewMemoryStore(),
+				kubeClient: fake.NewClientset(&node0, &node1, &node2),
+				matchers:   DefaultMatchers,
+				requests:   newRequestLog(),
+			}
+			_, _, err := s.store.Acquire(ctx, "default", c.holder, func(*RebootLock) error { return nil })
+			require.Nil(t, err)
+
+			s.reapGroup(ctx, "default", config)
+			lock, err := s.store.Get(ctx, "default")
+			require.Nil(t, err)
+			assert.Equal(t, !c.reclaim, lock.Holds(c.holder.ID))
+
+			// reclaimed Nodes finish rebooting
+			if c.reclaim && c.holder.Node == "node-0" {
+				node, err := s.kubeClient.CoreV1().Nodes().Get(ctx, "node-0", metav1.GetOptions{})
+				require.Nil(t, err)
+				assert.Equal(t, PhaseDone, node.Labels[phaseLabel])
+			}
+		})
+	}
+}
@@ -2,23 +2,49 @@ package fleetlock
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/collectors"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/sirupsen/logrus"
-	"k8s.io/apimachinery/pkg/api/errors"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/api/core/v1"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/record"
+
+	"github.com/poseidon/fleetlock/internal/drainer"
+)
+
+// List of lock storage backends
+const (
+	BackendKubernetes = "kubernetes"
+	BackendMemory     = "memory"
+	BackendFile       = "file"
+	BackendEtcd       = "etcd"
 )
 
 // Config configures a Fleetlock server.
 type Config struct {
 	// logger
 	Logger *logrus.Logger
+	// reboot group configurations
+	Groups *Groups
+	// lock storage backend (default kubernetes)
+	Backend string
+	// lock file path for the file backend
+	FilePath string
+	// etcd client configuration for the etcd backend
+	Etcd *EtcdConfig
+	// chain of strategies to match Zincati requests to Nodes (default
+	// DefaultMatchers)
+	Matchers []string
+	// serve Node matching diagnostics, which expose Node MachineIDs
+	Diagnostics bool
 }
 
 // Server implements the FleetLock protocol.
@@ -27,10 +53,20 @@ type Server struct {
 	log *logrus.Logger
 	// metrics
 	metrics *metrics
-
-	// Kubernetes
+	// reboot groups
+	groups *Groups
+	// reboot lock storage
+	store LockStore
+	// Zincati IDs seen in requests
+	requests *requestLog
+
+	// Kubernetes (optional for non-kubernetes backends)
 	namespace  string
 	kubeClient kubernetes.Interface
+	recorder   record.EventRecorder
+	nodes      *nodeCache
+	volumes    *volumeCache
+	matchers   []string
 }
 
 // NewServer returns a new fleetlock Server handler
@@ -39,6 +75,14 @@ func NewServer(config *Config) (http.Handler, error) {
 		return nil, fmt.Errorf("fleetlock: logger must not be nil")
 	}
 
+	matchers := config.Matchers
+	if matchers == nil {
+		matchers = DefaultMatchers
+	}
+	if err := validateMatchers(matchers); err != nil {
+		return nil, err
+	}
+
 	// set via downward API
 	namespace := os.Getenv("NAMESPACE")
 	if namespace == "" {
@@ -48,15 +92,22 @@ func NewServer(config *Config) (http.Handler, error) {
 	// set for development
 	kubeconfigPath := os.Getenv("KUBECONFIG")
 
-	// Kubernetes client from kubeconfig or service account (in-cluster)
-	kubeClient, err := newKubeClient(kubeconfigPath)
-	if err != nil {
-		return nil, fmt.Errorf("fleetlock: error creating Kubernetes client: %v", err)
+	// Kubernetes client from kubeconfig or service account (in-cluster),
+	// required by the kubernetes backend and Node features
+	var kubeClient kubernetes.Interface
+	if config.Backend == "" || config.Backend == BackendKubernetes || kubeConfigured(kubeconfigPath) {
+		var err error
+		kubeClient, err = newKubeClient(kubeconfigPath)
+		if err != nil {
+			return nil, fmt.Errorf("fleetlock: error creating Kubernetes client: %v", err)
+		}
+	} else {
+		config.Logger.Warn("fleetlock: no Kubernetes client configured, Node features (e.g. draining) disabled")
 	}
 
 	// create prometheus registry
 	registry := prometheus.NewRegistry()
-	err = registerAll(registry,
+	err := registerAll(registry,
 		collectors.NewGoCollector(),
 		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
 	)
@@ -73,8 +124,42 @@ func NewServer(config *Config) (http.Handler, error) {
 	s := &Server{
 		log:        config.Logger,
 		metrics:    metrics,
+		groups:     config.Groups,
 		namespace:  namespace,
 		kubeClient: kubeClient,
+		matchers:   matchers,
+		requests:   newRequestLog(),
+	}
+	if kubeClient != nil {
+		s.recorder = newEventRecorder(kubeClient)
+		s.nodes, err = newNodeCache(kubeClient)
+		if err != nil {
+			return nil, fmt.Errorf("fleetlock: error creating node cache: %v", err)
+		}
+		s.nodes.Run(context.Background())
+
+		// watch VolumeAttachments only if a group waits for them to detach
+		if s.groups.detachesVolumes() {
+			s.volumes, err = newVolumeCache(kubeClient)
+			if err != nil {
+				return nil, fmt.Errorf("fleetlock: error creating volume attachment cache: %v", err)
+			}
+			s.volumes.Run(context.Background())
+		}
+	}
+
+	s.store, err = s.newLockStore(config)
+	if err != nil {
+		return nil, err
+	}
+
+	// reclaim expired reboot lease holds
+	if s.groups.reapable() {
+		if kubeClient != nil {
+			go s.reap(context.Background(), reapInterval)
+		} else {
+			s.log.Warn("fleetlock: hold_timeout requires a Kubernetes client to check Nodes, holds won't be reclaimed")
+		}
 	}
 
 	mux := http.NewServeMux()
@@ -85,17 +170,36 @@ func NewServer(config *Config) (http.Handler, error) {
 	mux.Handle("/v1/steady-state", chain(http.HandlerFunc(s.unlock)))
 	mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
 	mux.Handle("/-/healthy", healthHandler())
+	mux.Handle("/-/ready", s.readyHandler())
+	if config.Diagnostics {
+		mux.Handle("/-/nodes", GETHandler(s.diagnosticsHandler()))
+	}
 	return mux, nil
 }
 
-// newRebootLease creates a reboot lease.
-func (s *Server) newRebootLease(group string) *RebootLease {
-	return &RebootLease{
-		Meta: metav1.ObjectMeta{
-			Name:      fmt.Sprintf("fleetlock-%s", group),
-			Namespace: s.namespace,
-		},
-		Client: s.kubeClient.CoordinationV1(),
+// newLockStore creates the configured LockStore.
+func (s *Server) newLockStore(config *Config) (LockStore, error) {
+	switch config.Backend {
+	case "", BackendKubernetes:
+		return NewLeaseStore(s.kubeClient.CoordinationV1(), s.namespace, func(group string) {
+			s.metrics.lockConflicts.With(prometheus.Labels{"group": group}).Inc()
+		}), nil
+	case BackendMemory:
+		return NewMemoryStore(), nil
+	case BackendFile:
+		if config.FilePath == "" {
+			return nil, fmt.Errorf("fleetlock: file backend requires a file path")
+		}
+		return NewFileStore(config.FilePath)
+	case BackendEtcd:
+		if config.Etcd == nil {
+			return nil, fmt.Errorf("fleetlock: etcd backend requires etcd configuration")
+		}
+		return NewEtcdStore(config.Etcd, func(group string) {
+			s.metrics.lockConflicts.With(prometheus.Labels{"group": group}).Inc()
+		})
+	default:
+		return nil, fmt.Errorf("fleetlock: unknown backend %q", config.Backend)
 	}
 }
 
@@ -110,7 +214,6 @@ func (s *Server) lock(w http.ResponseWriter, req *http.Request) {
 	}
 	id := msg.ClientParmas.ID
 	group := msg.ClientParmas.Group
-	rebootLease := s.newRebootLease(group)
 
 	fields := logrus.Fields{
 		"id":    id,
@@ -120,55 +223,203 @@ func (s *Server) lock(w http.ResponseWriter, req *http.Request) {
 	s.log.WithFields(fields).Info("fleetlock: attempt reboot lease lock")
 	s.metrics.lockRequests.Inc()
 
-	// get or create a reboot lease
+	// match the Node to assign its group and record its OS
 	ctx := context.Background()
-	lock, err := rebootLease.Get(ctx)
-	if err != nil {
-		if !errors.IsNotFound(err) {
-			s.log.Errorf("fleetlock: error getting reboot lease %s: %v", rebootLease.Name(), err)
-			encodeReply(w, NewReply(KindInternalError, "error getting reboot lease"))
-			return
+	var node *v1.Node
+	nodeName := ""
+	if s.kubeClient != nil {
+		if matched, err := s.matchNode(ctx, id); err == nil {
+			node = matched
+			nodeName = node.GetName()
+			s.requests.See(nodeName, time.Now())
 		}
 	}
 
-	fields["holder"] = lock.Holder
+	group, err = s.assignGroup(node, group, fields)
+	var denied *denial
+	if errors.As(err, &denied) {
+		s.log.WithFields(fields).Infof("fleetlock: %s", denied.reply.Value)
+		s.nodeEvent(group, nodeName, v1.EventTypeNormal, reasonLockDenied, "Reboot lock denied to %s: %s", id, denied.reply.Value)
+		encodeReply(w, denied.reply)
+		return
+	}
 
-	// reboot lease already owned by node
-	if lock.Holder == id {
-		s.log.WithFields(fields).Info("fleetlock: retained reboot lease")
-		s.metrics.lockState.With(prometheus.Labels{"group": group}).Set(1)
-		fmt.Fprint(w, "retained reboot lease")
+	// obtain a reboot lease slot, re-evaluated on conflicting updates
+	config := s.groups.Get(group)
+	holder := Holder{
+		ID:          id,
+		AcquireTime: time.Now(),
+		Duration:    config.HoldTimeout,
+	}
 
-		// best effort, do not gate on drain succeeding
-		_ = s.DrainNode(ctx, id)
-		return
+	// record the Node and its OS to compare after rebooting
+	if node != nil {
+		holder.Node = nodeName
+		holder.OSImage = node.Status.NodeInfo.OSImage
+		holder.KernelVersion = node.Status.NodeInfo.KernelVersion
+		holder.BootID = node.Status.NodeInfo.BootID
+		holder.Zone = nodeZone(node)
 	}
+	// holders of other groups, listed for control plane Nodes and zone limits
+	var others []Holder
+	admit := func(lock *RebootLock) error {
+		fields["holders"] = lock.HolderIDs()
+
+		// control plane Node waiting on workers or other control plane Nodes
+		if config.ControlPlaneLast && node != nil {
+			err := s.controlPlaneOrder(ctx, config, node, append(others, lock.Holders...))
+			if err != nil {
+				var denied *denial
+				if errors.As(err, &denied) {
+					return err
+				}
+				return fmt.Errorf("fleetlock: error checking control plane order: %v", err)
+			}
+		}
+
+		// unavailable Nodes budget exhausted
+		if config.MaxUnavailable != nil && s.kubeClient != nil {
+			budget, err := s.unavailableBudget(ctx, config, lock, id)
+			if err != nil {
+				return fmt.Errorf("fleetlock: error computing unavailable budget: %v", err)
+			}
+
+			if budget.Exhausted() {
+				return deny(KindLockHeld, "reboot lease lock unavailable, budget exhausted, %s", budget)
+			}
+		}
+
+		// reboots spread across the maximum number of zones
+		if config.MaxZones > 0 && s.kubeClient != nil {
+			zones, err := s.holderZones(ctx, append(others, lock.Holders...), id)
+			if err != nil {
+				return fmt.Errorf("fleetlock: error listing holder zones: %v", err)
+			}
+
+			zone := holder.Zone
+			if zone == "" {
+				zone = noZone
+			}
+			if exceedsZones(zones, zone, config.MaxZones) {
+				return deny(KindLockHeld, "reboot lease lock unavailable, nodes rebooting in zones %s (max %d)", strings.Join(zones, ", "), config.MaxZones)
+			}
+		}
+
+		// reboot lease slots held by different nodes
+		if len(lock.Holders) >= config.Slots() {
+			return deny(KindLockHeld, "reboot lease lock unavailable, held by %s", strings.Join(lock.HolderIDs(), ", "))
+		}
 
-	// reboot lease available
-	if lock.Holder == "" {
-		// obtain the reboot lease lock
 		s.log.WithFields(fields).Info("fleetlock: reboot lease available, attempt")
-		update := &RebootLock{
-			Holder:           id,
-			LeaseTransitions: lock.LeaseTransitions + 1,
-		}
-		err := rebootLease.Update(ctx, update)
-		if err == nil {
-			s.log.WithFields(fields).Info("fleetlock: obtained reboot lease")
-			s.metrics.lockState.With(prometheus.Labels{"group": group}).Set(1)
-			fmt.Fprintf(w, "obtained reboot lease")
-
-			// best effort, do not gate on drain succeeding
-			_ = s.DrainNode(ctx, id)
-			return
+		return nil
+	}
+
+	// control plane Nodes reboot last, one at a time across groups, by first
+	// holding the control plane lock group
+	heldControlPlane := false
+	controlPlane := config.ControlPlaneLast && node != nil && isControlPlane(node)
+	if controlPlane {
+		heldControlPlane, err = s.acquireControlPlane(ctx, holder)
+	}
+	if err == nil && (controlPlane || (config.MaxZones > 0 && s.kubeClient != nil)) {
+		others, err = s.otherHolders(ctx, group)
+	}
+	var lock *RebootLock
+	var acquired bool
+	if err == nil {
+		lock, acquired, err = s.store.Acquire(req.Context(), group, holder, admit)
+	}
+	if err != nil && heldControlPlane {
+		s.releaseControlPlane(ctx, holder.ID)
+	}
+
+	switch {
+	case errors.As(err, &denied):
+		s.log.WithFields(fields).Infof("fleetlock: %s", denied.reply.Value)
+		if lock != nil {
+			s.metrics.lockState.With(prometheus.Labels{"group": group}).Set(lockState(lock))
 		}
+		s.nodeEvent(group, nodeName, v1.EventTypeNormal, reasonLockDenied, "Reboot lock denied to %s: %s", id, denied.reply.Value)
+		encodeReply(w, denied.reply)
+		return
+	case err == ErrLockContention:
+		s.log.WithFields(fields).Errorf("fleetlock: error obtaining reboot lease: %v", err)
+		s.nodeEvent(group, nodeName, v1.EventTypeWarning, reasonLockFailed, "Reboot lock for %s undecided due to contention", id)
+		encodeReply(w, NewReply(KindLockContention, "reboot lease lock undecided due to contention, retry"))
+		return
+	case err != nil:
 		s.log.WithFields(fields).Errorf("fleetlock: error obtaining reboot lease: %v", err)
+		s.nodeEvent(group, nodeName, v1.EventTypeWarning, reasonLockFailed, "Error obtaining reboot lock for %s: %v", id, err)
+		encodeReply(w, NewReply(KindInternalError, "error obtaining reboot lease"))
+		return
 	}
 
-	// reboot lease held by different node
-	s.log.WithFields(fields).Info("fleetlock: reboot lease lock unavailable")
 	s.metrics.lockState.With(prometheus.Labels{"group": group}).Set(1)
-	encodeReply(w, NewReply(KindLockHeld, "reboot lease lock unavailable, held by %s", lock.Holder))
+	if acquired {
+		s.log.WithFields(fields).Info("fleetlock: obtained reboot lease")
+		s.nodeEvent(group, nodeName, v1.EventTypeNormal, reasonLockObtained, "Reboot lock obtained by %s in group %s", id, group)
+	} else {
+		s.log.WithFields(fields).Info("fleetlock: retained reboot lease")
+	}
+
+	// drain the Node, gating the lock on completion if configured to wait
+	s.setRebootPhase(ctx, group, nodeName, PhaseDraining)
+	err = s.DrainNode(ctx, group, id, &config.Drain)
+	if errors.Is(err, drain.ErrRefused) {
+		// nothing was evicted, so never reboot, even if draining is best effort,
+		// and free the slot for other nodes until the Pods are removed
+		s.log.WithFields(fields).Errorf("fleetlock: drain refused: %v", err)
+		s.refuseLock(ctx, group, config, nodeName, id, fields)
+		s.nodeEvent(group, nodeName, v1.EventTypeNormal, reasonLockDenied, "Reboot lock denied to %s: node drain refused: %v", id, err)
+		encodeReply(w, NewReply(KindDrainIncomplete, "reboot lease lock unavailable, node drain refused: %v", err))
+		return
+	}
+	if err != nil && config.Drain.Wait && !errors.Is(err, errNodeNotMatched) {
+		if errors.Is(err, drain.ErrTimeout) && config.Drain.TimeoutPolicy == DrainTimeoutProceed {
+			s.log.WithFields(fields).Warnf("fleetlock: drain incomplete, proceeding: %v", err)
+		} else {
+			// keep the hold, Zincati retries and draining resumes
+			s.log.WithFields(fields).Errorf("fleetlock: drain incomplete: %v", err)
+			encodeReply(w, NewReply(KindDrainIncomplete, "reboot lease held, but node drain incomplete: %v", err))
+			return
+		}
+	}
+
+	// best effort drains proceed, but note refused evictions in the reply
+	note := ""
+	var blocked *drain.BlockedError
+	if errors.As(err, &blocked) && !config.Drain.Wait {
+		s.log.WithFields(fields).Warnf("fleetlock: drain incomplete, proceeding: %v", err)
+		note = fmt.Sprintf(", but node drain incomplete: %v", err)
+	}
+
+	s.setRebootPhase(ctx, group, nodeName, PhaseRebooting)
+	if acquired {
+		fmt.Fprintf(w, "obtained reboot lease%s", note)
+	} else {
+		fmt.Fprintf(w, "retained reboot lease%s", note)
+	}
+}
+
+// refuseLock releases an id's reboot lease slot and control plane hold (if
+// any) after its drain was refused, and uncordons its Node if an earlier drain
+// cordoned it. Errors are logged, since the lock is denied regardless.
+func (s *Server) refuseLock(ctx context.Context, group string, config *GroupConfig, node, id string, fields logrus.Fields) {
+	update, err := s.store.Release(ctx, group, id, nil)
+	if err != nil {
+		s.log.WithFields(fields).Errorf("fleetlock: error releasing refused reboot lease: %v", err)
+	}
+	if update != nil {
+		s.metrics.lockState.With(prometheus.Labels{"group": group}).Set(lockState(update))
+	}
+	if config.ControlPlaneLast {
+		s.releaseControlPlane(ctx, id)
+	}
+
+	if err := s.UncordonNode(ctx, group, id, &config.Drain); err != nil && !errors.Is(err, errNodeNotMatched) {
+		s.log.WithFields(fields).Errorf("fleetlock: error uncordoning refused node: %v", err)
+	}
+	s.setRebootPhase(ctx, group, node, PhaseDone)
 }
 
 // unlock attempts to release a reboot lease lock.
@@ -182,7 +433,6 @@ func (s *Server) unlock(w http.ResponseWriter, req *http.Request) {
 	}
 	id := msg.ClientParmas.ID
 	group := msg.ClientParmas.Group
-	rebootLease := s.newRebootLease(group)
 
 	fields := logrus.Fields{
 		"id":    id,
@@ -192,57 +442,113 @@ func (s *Server) unlock(w http.ResponseWriter, req *http.Request) {
 	s.log.WithFields(fields).Info("fleetlock: attempt reboot lease unlock")
 	s.metrics.unlockRequests.Inc()
 
-	// get or create a reboot lease
+	// match the Node to assign its group (as when locking) and record Events
 	ctx := context.Background()
-	lock, err := rebootLease.Get(ctx)
-	if err != nil {
-		if !errors.IsNotFound(err) {
-			s.log.Errorf("fleetlock: error getting reboot lease %s: %v", rebootLease.Name(), err)
-			encodeReply(w, NewReply(KindInternalError, "error getting reboot lease"))
-			return
+	var node *v1.Node
+	nodeName := ""
+	if s.kubeClient != nil {
+		if matched, err := s.matchNode(ctx, id); err == nil {
+			node = matched
+			nodeName = node.GetName()
 		}
 	}
 
-	// reboot lease is owned by node
-	if lock.Holder == id {
-		err := s.UncordonNode(ctx, id)
-		if err != nil {
+	group, err = s.assignGroup(node, group, fields)
+	var denied *denial
+	if errors.As(err, &denied) {
+		s.log.WithFields(fields).Infof("fleetlock: %s", denied.reply.Value)
+		encodeReply(w, denied.reply)
+		return
+	}
+
+	// get or create a reboot lease
+	lock, err := s.store.Get(ctx, group)
+	if err != nil {
+		s.log.WithFields(fields).Errorf("fleetlock: error getting reboot lease: %v", err)
+		encodeReply(w, NewReply(KindInternalError, "error getting reboot lease"))
+		return
+	}
+
+	// reboot lease slot is owned by node
+	if holder, ok := lock.Holder(id); ok {
+		// check the Node is healthy after rebooting
+		s.setRebootPhase(ctx, group, nodeName, PhaseVerifying)
+		config := s.groups.Get(group)
+		gate := &config.UnlockGate
+		if gate.Enabled() && s.kubeClient != nil {
+			err := s.checkNode(ctx, gate, holder)
+			var denied *denial
+			if errors.As(err, &denied) {
+				s.log.WithFields(fields).Infof("fleetlock: %s", denied.reply.Value)
+				s.nodeEvent(group, nodeName, v1.EventTypeNormal, reasonUnlockDenied, "Reboot unlock denied to %s: %s", id, denied.reply.Value)
+				encodeReply(w, denied.reply)
+				return
+			}
+			if err != nil {
+				s.log.WithFields(fields).Errorf("fleetlock: error checking node: %v", err)
+				s.nodeEvent(group, nodeName, v1.EventTypeWarning, reasonLockFailed, "Error checking node %s before unlock: %v", id, err)
+				encodeReply(w, NewReply(KindInternalError, "error checking node"))
+				return
+			}
+		}
+
+		// unmatched Nodes weren't drained, so there's nothing to uncordon
+		err := s.UncordonNode(ctx, group, id, &config.Drain)
+		if err != nil && !errors.Is(err, errNodeNotMatched) {
 			s.log.Errorf("fleetlock: error uncordoning node: %v", err)
+			s.nodeEvent(group, nodeName, v1.EventTypeWarning, reasonLockFailed, "Error uncordoning node %s: %v", id, err)
 			encodeReply(w, NewReply(KindInternalError, "error uncordoning node"))
 			return
 		}
 
-		// release reboot lease lock
+		// release the node's control plane hold (if any) first, so retries
+		// still find the node's reboot lease slot
+		if config.ControlPlaneLast {
+			s.releaseControlPlane(ctx, holder.ID)
+		}
+
+		// release only the node's reboot lease slot
 		s.log.WithFields(fields).Info("fleetlock: unlock reboot lease")
-		update := &RebootLock{
-			Holder:           "",
-			LeaseTransitions: lock.LeaseTransitions,
+		update, err := s.store.Release(req.Context(), group, id, nil)
+		if err == ErrLockContention {
+			s.log.WithFields(fields).Errorf("fleetlock: error unlocking reboot lease: %v", err)
+			encodeReply(w, NewReply(KindLockContention, "reboot lease unlock undecided due to contention, retry"))
+			return
 		}
-		err = rebootLease.Update(ctx, update)
 		if err != nil {
 			s.log.WithFields(fields).Errorf("fleetlock: error unlocking reboot lease: %v", err)
 			encodeReply(w, NewReply(KindInternalError, "error unlocking reboot lease"))
 			return
 		}
 
-		s.metrics.lockState.With(prometheus.Labels{"group": group}).Set(0)
+		s.metrics.lockState.With(prometheus.Labels{"group": group}).Set(lockState(update))
 		s.metrics.lockTransitions.With(prometheus.Labels{"group": group}).Inc()
 		s.log.WithFields(fields).Info("fleetlock: unlocked reboot lease")
-		fmt.Fprintf(w, "unlocked reboot lease for %s", lock.Holder)
+		s.nodeEvent(group, nodeName, v1.EventTypeNormal, reasonLockReleased, "Reboot lock released by %s in group %s", id, group)
+		s.setRebootPhase(ctx, group, nodeName, PhaseDone)
+		fmt.Fprintf(w, "unlocked reboot lease for %s", id)
 		return
 	}
 
 	// reboot lease available
-	if lock.Holder == "" {
+	if len(lock.Holders) == 0 {
 		s.metrics.lockState.With(prometheus.Labels{"group": group}).Set(0)
 		fmt.Fprint(w, "reboot lease already unlocked")
 		return
 	}
 
-	// reboot lease held by different node
+	// reboot lease held by different nodes
 	s.log.WithFields(fields).Info("fleetlock: reboot lease unlock unavailable")
 	s.metrics.lockState.With(prometheus.Labels{"group": group}).Set(1)
-	encodeReply(w, NewReply(KindLockHeld, "reboot lease unlock unavailable, held by %s", lock.Holder))
+	encodeReply(w, NewReply(KindLockHeld, "reboot lease unlock unavailable, held by %s", strings.Join(lock.HolderIDs(), ", ")))
+}
+
+// lockState returns the lock state metric value for a RebootLock.
+func lockState(lock *RebootLock) float64 {
+	if len(lock.Holders) > 0 {
+		return 1
+	}
+	return 0
 }
 
 // healthHandler handles liveness checks with an ok status response.
@@ -0,0 +1,174 @@
+package fleetlock
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// newTestServer returns a Server with a memory store and a fake Kubernetes
+// client of the given objects.
+func newTestServer(groups *Groups, objects ...runtime.Object) *Server {
+	client := fake.NewClientset(objects...)
+	client.Fake.Resources = []*metav1.APIResourceList{
+		{
+			GroupVersion: "v1",
+			APIResources: []metav1.APIResource{
+				{Name: "pods/eviction", Kind: "Eviction", Group: "policy", Version: "v1", Namespaced: true},
+			},
+		},
+	}
+	return &Server{
+		log:        logrus.New(),
+		metrics:    newMetrics(),
+		groups:     groups,
+		store:      NewMemoryStore(),
+		kubeClient: client,
+		matchers:   DefaultMatchers,
+		requests:   newRequestLog(),
+	}
+}
+
+// lockRequest sends a pre-reboot request for the given id and group.
+func lockRequest(s *Server, id, group string) *httptest.ResponseRecorder {
+	body := fmt.Sprintf(`{"client_params": {"id": %q, "group": %q}}`, id, group)
+	w := httptest.NewRecorder()
+	s.lock(w, httptest.NewRequest("POST", "/v1/pre-reboot", strings.NewReader(body)))
+	return w
+}
+
+// unlockRequest sends a steady-state request for the given id and group.
+func unlockRequest(s *Server, id, group string) *httptest.ResponseRecorder {
+	body := fmt.Sprintf(`{"client_params": {"id": %q, "group": %q}}`, id, group)
+	w := httptest.NewRecorder()
+	s.unlock(w, httptest.NewRequest("POST", "/v1/steady-state", strings.NewReader(body)))
+	return w
+}
+
+func TestLockDrainRefused(t *testing.T) {
+	node := testNode(0)
+	id, _ := ZincatiID(node.Status.NodeInfo.MachineID)
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "unmanaged", Namespace: "default"},
+		Spec:       v1.PodSpec{NodeName: "node-0"},
+	}
+
+	// refused drains deny the lock, even if draining is best effort
+	groups := &Groups{
+		Groups: map[string]*GroupConfig{
+			"default": {Drain: DrainConfig{UnmanagedPods: DrainUnmanagedRefuse}},
+		},
+	}
+	s := newTestServer(groups, &node, pod)
+	w := lockRequest(s, id, "default")
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	reply := Reply{}
+	require.Nil(t, json.NewDecoder(w.Body).Decode(&reply))
+	assert.Equal(t, KindDrainIncomplete, reply.Kind)
+	assert.Contains(t, reply.Value, "default/unmanaged")
+
+	// without keeping the hold or cordoning the Node
+	lock, err := s.store.Get(context.Background(), "default")
+	require.Nil(t, err)
+	assert.Empty(t, lock.Holders)
+	cordoned, err := s.kubeClient.CoreV1().Nodes().Get(context.Background(), "node-0", metav1.GetOptions{})
+	require.Nil(t, err)
+	assert.False(t, cordoned.Spec.Unschedulable)
+
+	// unmanaged Pods are evicted by default
+	s = newTestServer(nil, &node, pod)
+	w = lockRequest(s, id, "default")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "obtained reboot lease", w.Body.String())
+}
+
+func TestLockControlPlaneSerialized(t *testing.T) {
+	ctx := context.Background()
+	node0, node1 := testNode(0), testNode(1)
+	node0.Labels = map[string]string{"node.kubernetes.io/controller": "true"}
+	node1.Labels = map[string]string{"node.kubernetes.io/controller": "true"}
+	id0, _ := ZincatiID(node0.Status.NodeInfo.MachineID)
+	id1, _ := ZincatiID(node1.Status.NodeInfo.MachineID)
+	groups := &Groups{
+		Groups: map[string]*GroupConfig{
+			"a": {ControlPlaneLast: true},
+			"b": {ControlPlaneLast: true},
+		},
+	}
+	s := newTestServer(groups, &node0, &node1)
+
+	// orphaned control plane holds are released
+	orphan := Holder{ID: "orphan", AcquireTime: time.Now().Add(-2 * orphanedHoldAge)}
+	_, _, err := s.store.Acquire(ctx, controlPlaneGroup, orphan, func(*RebootLock) error { return nil })
+	require.Nil(t, err)
+
+	// one control plane Node reboots at a time, across groups
+	w := lockRequest(s, id0, "a")
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = lockRequest(s, id1, "b")
+	assert.Equal(t, http.StatusLocked, w.Code)
+	assert.Contains(t, w.Body.String(), "node-0 is rebooting")
+	lock, err := s.store.Get(ctx, controlPlaneGroup)
+	require.Nil(t, err)
+	assert.Equal(t, []string{id0}, lock.HolderIDs())
+
+	// until the rebooting Node unlocks
+	w = unlockRequest(s, id0, "a")
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = lockRequest(s, id1, "b")
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestUnlockUnmatched(t *testing.T) {
+	// holds of ids that match no Node are released, even with an unlock gate
+	groups := &Groups{
+		Groups: map[string]*GroupConfig{
+			"default": {UnlockGate: UnlockGate{NodeReady: true, OSChanged: true}},
+		},
+	}
+	node := testNode(0)
+	s := newTestServer(groups, &node)
+	w := lockRequest(s, "unmatched", "default")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = unlockRequest(s, "unmatched", "default")
+	assert.Equal(t, http.StatusOK, w.Code)
+	lock, err := s.store.Get(context.Background(), "default")
+	require.Nil(t, err)
+	assert.Empty(t, lock.Holders)
+}
+
+func TestLockZonesAcrossGroups(t *testing.T) {
+	node0, node1 := testNode(0), testNode(1)
+	node0.Labels = map[string]string{v1.LabelTopologyZone: "zone-a"}
+	node1.Labels = map[string]string{v1.LabelTopologyZone: "zone-b"}
+	id0, _ := ZincatiID(node0.Status.NodeInfo.MachineID)
+	id1, _ := ZincatiID(node1.Status.NodeInfo.MachineID)
+	groups := &Groups{
+		Groups: map[string]*GroupConfig{
+			"a": {MaxZones: 1},
+			"b": {MaxZones: 1},
+		},
+	}
+	s := newTestServer(groups, &node0, &node1)
+
+	// reboots in other groups count towards the zone limit
+	w := lockRequest(s, id0, "a")
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = lockRequest(s, id1, "b")
+	assert.Equal(t, http.StatusLocked, w.Code)
+	assert.Contains(t, w.Body.String(), "zone-a")
+}
@@ -0,0 +1,100 @@
+package fleetlock
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	// Node condition type set while a Node reboots
+	conditionRebootInProgress v1.NodeConditionType = "FleetlockRebootInProgress"
+	// Node label set to the reboot phase
+	phaseLabel = "fleetlock.poseidon/phase"
+)
+
+// List of Node reboot phases
+const (
+	PhaseDraining  = "draining"
+	PhaseRebooting = "rebooting"
+	PhaseVerifying = "verifying"
+	PhaseDone      = "done"
+)
+
+// setRebootPhase reports the reboot phase of the named Kubernetes Node (if
+// any). Errors are logged, since the phase is only informational.
+func (s *Server) setRebootPhase(ctx context.Context, group, node, phase string) {
+	// reporting requires a Kubernetes client and a matched Node
+	if s.kubeClient == nil || node == "" {
+		return
+	}
+
+	fields := logrus.Fields{
+		"node":  node,
+		"group": group,
+		"phase": phase,
+	}
+
+	if err := s.patchRebootPhase(ctx, node, group, phase); err != nil {
+		s.log.WithFields(fields).Warnf("fleetlock: error setting reboot phase: %v", err)
+	}
+}
+
+// patchRebootPhase labels a Node with its reboot phase and sets the reboot
+// in progress condition via the status subresource, or removes the condition
+// once done.
+func (s *Server) patchRebootPhase(ctx context.Context, node, group, phase string) error {
+	labels, err := json.Marshal(map[string]any{
+		"metadata": map[string]any{
+			"labels": map[string]string{phaseLabel: phase},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = s.kubeClient.CoreV1().Nodes().Patch(ctx, node, types.MergePatchType, labels, metav1.PatchOptions{})
+	if err != nil {
+		return err
+	}
+
+	status, err := json.Marshal(map[string]any{
+		"status": map[string]any{
+			"conditions": []any{rebootCondition(group, phase, time.Now())},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = s.kubeClient.CoreV1().Nodes().Patch(ctx, node, types.StrategicMergePatchType, status, metav1.PatchOptions{}, "status")
+	return err
+}
+
+// rebootCondition returns the strategic merge patch entry of the reboot in
+// progress condition for a phase.
+func rebootCondition(group, phase string, now time.Time) map[string]any {
+	if phase == PhaseDone {
+		return map[string]any{
+			"type":   conditionRebootInProgress,
+			"$patch": "delete",
+		}
+	}
+	condition := map[string]any{
+		"type":              conditionRebootInProgress,
+		"status":            v1.ConditionTrue,
+		"reason":            strings.ToUpper(phase[:1]) + phase[1:],
+		"message":           fmt.Sprintf("fleetlock reboot group %s node %s", group, phase),
+		"lastHeartbeatTime": metav1.NewTime(now),
+	}
+	// the condition becomes true when draining starts
+	if phase == PhaseDraining {
+		condition["lastTransitionTime"] = metav1.NewTime(now)
+	}
+	return condition
+}
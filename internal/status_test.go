@@ -0,0 +1,43 @@
+package fleetlock
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestPatchRebootPhase(t *testing.T) {
+	ctx := context.Background()
+	node := testNode(0)
+	client := fake.NewClientset(&node)
+	s := &Server{kubeClient: client}
+
+	// phases label the Node and set the condition
+	for _, phase := range []string{PhaseDraining, PhaseRebooting, PhaseVerifying} {
+		err := s.patchRebootPhase(ctx, node.GetName(), "default", phase)
+		assert.Nil(t, err)
+
+		current, err := client.CoreV1().Nodes().Get(ctx, node.GetName(), metav1.GetOptions{})
+		assert.Nil(t, err)
+		assert.Equal(t, phase, current.Labels[phaseLabel])
+		assert.Len(t, current.Status.Conditions, 2)
+		for _, condition := range current.Status.Conditions {
+			if condition.Type == conditionRebootInProgress {
+				assert.Equal(t, v1.ConditionTrue, condition.Status)
+				assert.Equal(t, "fleetlock reboot group default node "+phase, condition.Message)
+			}
+		}
+	}
+
+	// once done, the condition is cleared and other conditions kept
+	err := s.patchRebootPhase(ctx, node.GetName(), "default", PhaseDone)
+	assert.Nil(t, err)
+	current, err := client.CoreV1().Nodes().Get(ctx, node.GetName(), metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, PhaseDone, current.Labels[phaseLabel])
+	assert.Equal(t, []v1.NodeCondition{{Type: v1.NodeReady, Status: v1.ConditionTrue}}, current.Status.Conditions)
+}
@@ -0,0 +1,145 @@
+package fleetlock
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ErrLockContention indicates a RebootLock could not be updated because of
+// repeated conflicting updates.
+var ErrLockContention = fmt.Errorf("fleetlock: reboot lock update conflicts")
+
+// LockStore stores the RebootLock of each reboot group.
+type LockStore interface {
+	// Get returns the RebootLock of a group.
+	Get(ctx context.Context, group string) (*RebootLock, error)
+	// Acquire adds a holder to a group's RebootLock, if admitted. Returns the
+	// latest RebootLock and whether the holder was newly added.
+	Acquire(ctx context.Context, group string, holder Holder, admit AdmitFunc) (*RebootLock, bool, error)
+	// Release removes a holder id from a group's RebootLock, if admitted (nil
+	// admits any release). Returns the latest RebootLock.
+	Release(ctx context.Context, group string, id string, admit AdmitFunc) (*RebootLock, error)
+	// List returns the RebootLock of each group.
+	List(ctx context.Context) (map[string]*RebootLock, error)
+}
+
+// AdmitFunc decides whether a node may be added to (or removed from) the
+// holders of a RebootLock. Return an error to deny.
+type AdmitFunc func(lock *RebootLock) error
+
+// RebootLock represents nodes wishing to reboot.
+type RebootLock struct {
+	Holders          []Holder `json:"holders"`
+	LeaseTransitions int32    `json:"leaseTransitions"`
+}
+
+// Holder represents a node holding a reboot slot.
+type Holder struct {
+	ID          string    `json:"id"`
+	AcquireTime time.Time `json:"acquireTime"`
+	// name of the holder's Node when the hold was acquired (optional)
+	Node string `json:"node,omitempty"`
+	// duration after which the hold may be reclaimed (optional)
+	Duration metav1.Duration `json:"duration,omitzero"`
+	// Node OS image, kernel version, and boot ID when the hold was acquired
+	// (optional)
+	OSImage       string `json:"osImage,omitempty"`
+	KernelVersion string `json:"kernelVersion,omitempty"`
+	BootID        string `json:"bootID,omitempty"`
+	// Node topology zone when the hold was acquired (optional)
+	Zone string `json:"zone,omitempty"`
+}
+
+// Holds returns true if the given id holds a reboot slot.
+func (l *RebootLock) Holds(id string) bool {
+	for _, holder := range l.Holders {
+		if holder.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// Holder returns the holder with the given id, if present.
+func (l *RebootLock) Holder(id string) (Holder, bool) {
+	for _, holder := range l.Holders {
+		if holder.ID == id {
+			return holder, true
+		}
+	}
+	return Holder{}, false
+}
+
+// HolderIDs returns the ids of nodes holding reboot slots.
+func (l *RebootLock) HolderIDs() []string {
+	ids := make([]string, 0, len(l.Holders))
+	for _, holder := range l.Holders {
+		ids = append(ids, holder.ID)
+	}
+	return ids
+}
+
+// Acquire returns a RebootLock with the given holder added.
+func (l *RebootLock) Acquire(holder Holder) *RebootLock {
+	holders := make([]Holder, len(l.Holders), len(l.Holders)+1)
+	copy(holders, l.Holders)
+	return &RebootLock{
+		Holders:          append(holders, holder),
+		LeaseTransitions: l.LeaseTransitions + 1,
+	}
+}
+
+// Release returns a RebootLock with the given id removed as a holder.
+func (l *RebootLock) Release(id string) *RebootLock {
+	holders := []Holder{}
+	for _, holder := range l.Holders {
+		if holder.ID != id {
+			holders = append(holders, holder)
+		}
+	}
+	return &RebootLock{
+		Holders:          holders,
+		LeaseTransitions: l.LeaseTransitions,
+	}
+}
+
+// Expired returns holders which acquired a reboot slot longer than the given
+// timeout ago.
+func (l *RebootLock) Expired(timeout time.Duration, now time.Time) []Holder {
+	expired := []Holder{}
+	for _, holder := range l.Holders {
+		if now.Sub(holder.AcquireTime) > timeout {
+			expired = append(expired, holder)
+		}
+	}
+	return expired
+}
+
+// acquire returns the RebootLock update which adds a holder, if admitted, or
+// nil if the holder already holds a reboot slot.
+func acquire(lock *RebootLock, holder Holder, admit AdmitFunc) (*RebootLock, error) {
+	if lock.Holds(holder.ID) {
+		return nil, nil
+	}
+	if err := admit(lock); err != nil {
+		return nil, err
+	}
+	return lock.Acquire(holder), nil
+}
+
+// release returns the RebootLock update which removes a holder, if admitted,
+// or nil if the id holds no reboot slot.
+func release(lock *RebootLock, id string, admit AdmitFunc) (*RebootLock, error) {
+	if !lock.Holds(id) {
+		return nil, nil
+	}
+	if admit != nil {
+		if err := admit(lock); err != nil {
+			return nil, err
+		}
+	}
+	return lock.Release(id), nil
+}
@@ -0,0 +1,146 @@
+package fleetlock
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestRebootLockSlots(t *testing.T) {
+	now := time.Date(2022, 1, 2, 3, 4, 5, 0, time.UTC)
+	lock := &RebootLock{Holders: []Holder{}}
+
+	lock = lock.Acquire(Holder{ID: "a", AcquireTime: now})
+	lock = lock.Acquire(Holder{ID: "b", AcquireTime: now})
+	assert.True(t, lock.Holds("a"))
+	assert.True(t, lock.Holds("b"))
+	assert.Equal(t, []string{"a", "b"}, lock.HolderIDs())
+	assert.Equal(t, int32(2), lock.LeaseTransitions)
+
+	// release only the caller's slot
+	lock = lock.Release("a")
+	assert.False(t, lock.Holds("a"))
+	assert.Equal(t, []string{"b"}, lock.HolderIDs())
+	assert.Equal(t, int32(2), lock.LeaseTransitions)
+}
+
+func TestRebootLockExpiry(t *testing.T) {
+	now := time.Date(2022, 1, 2, 3, 4, 5, 0, time.UTC)
+	lock := &RebootLock{Holders: []Holder{}}
+	lock = lock.Acquire(Holder{ID: "a", AcquireTime: now.Add(-2 * time.Hour)})
+	lock = lock.Acquire(Holder{ID: "b", AcquireTime: now.Add(-10 * time.Minute)})
+
+	expired := lock.Expired(30*time.Minute, now)
+	assert.Equal(t, []Holder{{ID: "a", AcquireTime: now.Add(-2 * time.Hour)}}, expired)
+}
+
+func TestLockStores(t *testing.T) {
+	fileStore, err := NewFileStore(filepath.Join(t.TempDir(), "locks.json"))
+	assert.Nil(t, err)
+
+	stores := map[string]LockStore{
+		"memory":     NewMemoryStore(),
+		"file":       fileStore,
+		"kubernetes": NewLeaseStore(fake.NewClientset().CoordinationV1(), "default", nil),
+	}
+
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			testLockStore(t, store)
+		})
+	}
+}
+
+// testLockStore checks the behavior expected of every LockStore.
+func testLockStore(t *testing.T, store LockStore) {
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Second)
+	slots := func(n int) AdmitFunc {
+		return func(lock *RebootLock) error {
+			if len(lock.Holders) >= n {
+				return fmt.Errorf("held by %v", lock.HolderIDs())
+			}
+			return nil
+		}
+	}
+
+	// unknown groups are unlocked
+	lock, err := store.Get(ctx, "default")
+	assert.Nil(t, err)
+	assert.Empty(t, lock.Holders)
+
+	lock, acquired, err := store.Acquire(ctx, "default", Holder{ID: "a", AcquireTime: now}, slots(2))
+	assert.Nil(t, err)
+	assert.True(t, acquired)
+	assert.Equal(t, []string{"a"}, lock.HolderIDs())
+
+	// holders retain their slot without admission
+	_, acquired, err = store.Acquire(ctx, "default", Holder{ID: "a", AcquireTime: now}, slots(0))
+	assert.Nil(t, err)
+	assert.False(t, acquired)
+
+	_, acquired, err = store.Acquire(ctx, "default", Holder{ID: "b", AcquireTime: now}, slots(2))
+	assert.Nil(t, err)
+	assert.True(t, acquired)
+
+	// denied by admission
+	lock, acquired, err = store.Acquire(ctx, "default", Holder{ID: "c", AcquireTime: now}, slots(2))
+	assert.NotNil(t, err)
+	assert.False(t, acquired)
+	assert.Equal(t, []string{"a", "b"}, lock.HolderIDs())
+
+	// groups are independent
+	_, acquired, err = store.Acquire(ctx, "workers", Holder{ID: "c", AcquireTime: now}, slots(1))
+	assert.Nil(t, err)
+	assert.True(t, acquired)
+
+	lock, err = store.Release(ctx, "default", "a", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"b"}, lock.HolderIDs())
+
+	lock, err = store.Get(ctx, "default")
+	assert.Nil(t, err)
+	assert.Equal(t, []Holder{{ID: "b", AcquireTime: now}}, lock.Holders)
+	assert.Equal(t, int32(2), lock.LeaseTransitions)
+
+	// release of a non-holder is a no-op
+	lock, err = store.Release(ctx, "default", "z", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"b"}, lock.HolderIDs())
+
+	// denied by admission
+	lock, err = store.Release(ctx, "default", "b", unchangedHold(Holder{ID: "b", AcquireTime: now.Add(-time.Minute)}))
+	assert.Equal(t, errHoldChanged, err)
+	assert.Equal(t, []string{"b"}, lock.HolderIDs())
+
+	locks, err := store.List(ctx)
+	assert.Nil(t, err)
+	assert.Len(t, locks, 2)
+	assert.Equal(t, []string{"b"}, locks["default"].HolderIDs())
+	assert.Equal(t, []string{"c"}, locks["workers"].HolderIDs())
+}
+
+func TestFileStoreDurable(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "locks.json")
+	now := time.Now().UTC().Truncate(time.Second)
+	holder := Holder{ID: "a", AcquireTime: now, Duration: metav1.Duration{Duration: time.Hour}}
+
+	store, err := NewFileStore(path)
+	assert.Nil(t, err)
+	_, _, err = store.Acquire(ctx, "default", holder, func(*RebootLock) error { return nil })
+	assert.Nil(t, err)
+
+	// locks survive restarts
+	store, err = NewFileStore(path)
+	assert.Nil(t, err)
+	lock, err := store.Get(ctx, "default")
+	assert.Nil(t, err)
+	assert.Equal(t, []Holder{holder}, lock.Holders)
+}
@@ -0,0 +1,124 @@
+package fleetlock
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+// volumePollInterval is the interval between checks for attached volumes.
+const volumePollInterval = 5 * time.Second
+
+// volumeNodeIndex indexes VolumeAttachments by Node name.
+const volumeNodeIndex = "node"
+
+// volumeCache caches VolumeAttachments via a shared informer, indexed by Node.
+type volumeCache struct {
+	factory  informers.SharedInformerFactory
+	informer cache.SharedIndexInformer
+}
+
+// newVolumeCache returns a VolumeAttachment cache, which must be started with
+// Run.
+func newVolumeCache(client kubernetes.Interface) (*volumeCache, error) {
+	factory := informers.NewSharedInformerFactory(client, 0)
+	c := &volumeCache{
+		factory:  factory,
+		informer: factory.Storage().V1().VolumeAttachments().Informer(),
+	}
+
+	err := c.informer.AddIndexers(cache.Indexers{
+		volumeNodeIndex: func(obj any) ([]string, error) {
+			if attachment, ok := obj.(*storagev1.VolumeAttachment); ok {
+				return []string{attachment.Spec.NodeName}, nil
+			}
+			return nil, nil
+		},
+	})
+	return c, err
+}
+
+// Run starts watching VolumeAttachments until the context is done.
+func (c *volumeCache) Run(ctx context.Context) {
+	c.factory.Start(ctx.Done())
+}
+
+// Synced returns true once the cache has listed all VolumeAttachments.
+func (c *volumeCache) Synced() bool {
+	return c.informer.HasSynced()
+}
+
+// ByNode returns the cached VolumeAttachments of the named Node.
+func (c *volumeCache) ByNode(node string) ([]storagev1.VolumeAttachment, error) {
+	objs, err := c.informer.GetIndexer().ByIndex(volumeNodeIndex, node)
+	if err != nil {
+		return nil, err
+	}
+
+	attachments := make([]storagev1.VolumeAttachment, 0, len(objs))
+	for _, obj := range objs {
+		if attachment, ok := obj.(*storagev1.VolumeAttachment); ok {
+			attachments = append(attachments, *attachment)
+		}
+	}
+	return attachments, nil
+}
+
+// waitForVolumeDetach waits until no VolumeAttachments attach volumes to the
+// named Node, up to the timeout. Returns the volumes still attached.
+func (s *Server) waitForVolumeDetach(ctx context.Context, node string, timeout, interval time.Duration) ([]string, error) {
+	attached := []string{}
+	err := wait.PollUntilContextTimeout(ctx, interval, timeout, true, func(ctx context.Context) (bool, error) {
+		attachments, err := s.listVolumeAttachments(ctx, node)
+		if err != nil {
+			return false, err
+		}
+		attached = attachedVolumes(attachments, node)
+		return len(attached) == 0, nil
+	})
+	if wait.Interrupted(err) {
+		return attached, nil
+	}
+	return attached, err
+}
+
+// listVolumeAttachments lists the VolumeAttachments of the named Node, from
+// the VolumeAttachment cache once synced or from the API server.
+func (s *Server) listVolumeAttachments(ctx context.Context, node string) ([]storagev1.VolumeAttachment, error) {
+	if s.volumes != nil && s.volumes.Synced() {
+		return s.volumes.ByNode(node)
+	}
+
+	attachments, err := s.kubeClient.StorageV1().VolumeAttachments().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	return attachments.Items, nil
+}
+
+// attachedVolumes returns the names of VolumeAttachments with volumes still
+// attached to the named Node.
+func attachedVolumes(attachments []storagev1.VolumeAttachment, node string) []string {
+	attached := []string{}
+	for _, attachment := range attachments {
+		if attachment.Spec.NodeName == node && attachment.Status.Attached {
+			attached = append(attached, attachmentName(attachment))
+		}
+	}
+	return attached
+}
+
+// attachmentName describes a VolumeAttachment by its PersistentVolume, if any.
+func attachmentName(attachment storagev1.VolumeAttachment) string {
+	if pv := attachment.Spec.Source.PersistentVolumeName; pv != nil {
+		return strings.Join([]string{attachment.GetName(), *pv}, "/")
+	}
+	return attachment.GetName()
+}
@@ -0,0 +1,89 @@
+package fleetlock
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// testAttachment returns a VolumeAttachment of a PersistentVolume to a Node.
+func testAttachment(name, node string, attached bool) *storagev1.VolumeAttachment {
+	pv := "pv-" + name
+	return &storagev1.VolumeAttachment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: name,
+		},
+		Spec: storagev1.VolumeAttachmentSpec{
+			Attacher: "csi.example.com",
+			NodeName: node,
+			Source: storagev1.VolumeAttachmentSource{
+				PersistentVolumeName: &pv,
+			},
+		},
+		Status: storagev1.VolumeAttachmentStatus{
+			Attached: attached,
+		},
+	}
+}
+
+func TestAttachedVolumes(t *testing.T) {
+	attachments := []storagev1.VolumeAttachment{
+		*testAttachment("a", "node-0", true),
+		*testAttachment("b", "node-0", false),
+		*testAttachment("c", "node-1", true),
+	}
+	assert.Equal(t, []string{"a/pv-a"}, attachedVolumes(attachments, "node-0"))
+	assert.Equal(t, []string{"c/pv-c"}, attachedVolumes(attachments, "node-1"))
+	assert.Empty(t, attachedVolumes(attachments, "node-2"))
+}
+
+func TestWaitForVolumeDetach(t *testing.T) {
+	ctx := context.Background()
+
+	// volumes detached while waiting
+	client := fake.NewClientset(testAttachment("a", "node-0", true))
+	s := &Server{kubeClient: client}
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		client.StorageV1().VolumeAttachments().Delete(ctx, "a", metav1.DeleteOptions{})
+	}()
+	attached, err := s.waitForVolumeDetach(ctx, "node-0", 5*time.Second, 10*time.Millisecond)
+	assert.Nil(t, err)
+	assert.Empty(t, attached)
+
+	// volumes still attached after the timeout
+	client = fake.NewClientset(testAttachment("a", "node-0", true))
+	s = &Server{kubeClient: client}
+	attached, err = s.waitForVolumeDetach(ctx, "node-0", 50*time.Millisecond, 10*time.Millisecond)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a/pv-a"}, attached)
+}
+
+func TestVolumeCache(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := fake.NewClientset(testAttachment("a", "node-0", true), testAttachment("b", "node-1", true))
+
+	c, err := newVolumeCache(client)
+	assert.Nil(t, err)
+	c.Run(ctx)
+	assert.Eventually(t, c.Synced, 5*time.Second, 10*time.Millisecond)
+
+	// VolumeAttachments are indexed by Node
+	s := &Server{kubeClient: client, volumes: c}
+	attachments, err := s.listVolumeAttachments(ctx, "node-0")
+	assert.Nil(t, err)
+	assert.Len(t, attachments, 1)
+	assert.Equal(t, "a", attachments[0].GetName())
+
+	// waiting follows deletions
+	go client.StorageV1().VolumeAttachments().Delete(ctx, "a", metav1.DeleteOptions{})
+	attached, err := s.waitForVolumeDetach(ctx, "node-0", 5*time.Second, 10*time.Millisecond)
+	assert.Nil(t, err)
+	assert.Empty(t, attached)
+}
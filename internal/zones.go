@@ -0,0 +1,62 @@
+package fleetlock
+
+import (
+	"context"
+	"sort"
+
+	"k8s.io/api/core/v1"
+)
+
+// noZone is the zone of Nodes without a topology zone label.
+const noZone = "none"
+
+// nodeZone returns the topology zone of a Node, or noZone if unlabeled.
+func nodeZone(node *v1.Node) string {
+	if zone := node.GetLabels()[v1.LabelTopologyZone]; zone != "" {
+		return zone
+	}
+	return noZone
+}
+
+// holderZones returns the sorted zones of Nodes holding a reboot slot (in any
+// group), excluding the holder with the given id. Holds recorded without a
+// zone are resolved by matching the holder's Node.
+func (s *Server) holderZones(ctx context.Context, holders []Holder, id string) ([]string, error) {
+	set := map[string]bool{}
+	for _, holder := range holders {
+		if holder.ID == id {
+			continue
+		}
+
+		zone := holder.Zone
+		if zone == "" {
+			zone = noZone
+			node, _, err := s.findNode(ctx, holder.ID)
+			if err != nil {
+				return nil, err
+			}
+			if node != nil {
+				zone = nodeZone(node)
+			}
+		}
+		set[zone] = true
+	}
+
+	zones := make([]string, 0, len(set))
+	for zone := range set {
+		zones = append(zones, zone)
+	}
+	sort.Strings(zones)
+	return zones, nil
+}
+
+// exceedsZones returns true if adding a reboot in a zone would spread reboots
+// across more than the maximum number of zones.
+func exceedsZones(zones []string, zone string, max int) bool {
+	for _, other := range zones {
+		if other == zone {
+			return false
+		}
+	}
+	return len(zones)+1 > max
+}
@@ -0,0 +1,58 @@
+package fleetlock
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestExceedsZones(t *testing.T) {
+	cases := []struct {
+		zones    []string
+		zone     string
+		max      int
+		expected bool
+	}{
+		{[]string{}, "a", 1, false},
+		{[]string{"a"}, "a", 1, false},
+		{[]string{"a"}, "b", 1, true},
+		{[]string{"a"}, "b", 2, false},
+		{[]string{"a", "b"}, "c", 2, true},
+		{[]string{"a", "b"}, "b", 2, false},
+		{[]string{"a"}, noZone, 1, true},
+	}
+
+	for _, c := range cases {
+		assert.Equal(t, c.expected, exceedsZones(c.zones, c.zone, c.max))
+	}
+}
+
+func TestHolderZones(t *testing.T) {
+	// node-2 holds a slot recorded without a zone
+	node2 := testNode(2)
+	node2.Labels = map[string]string{v1.LabelTopologyZone: "c"}
+	id2, _ := ZincatiID(node2.Status.NodeInfo.MachineID)
+	s := &Server{
+		kubeClient: fake.NewClientset(&node2),
+		matchers:   DefaultMatchers,
+	}
+
+	holders := []Holder{
+		{ID: "a", Zone: "b"},
+		{ID: "b", Zone: "a"},
+		{ID: "c", Zone: "a"},
+		{ID: id2},
+		{ID: "unknown"},
+	}
+	zones, err := s.holderZones(context.Background(), holders, "b")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a", "b", "c", noZone}, zones)
+
+	// requesting holders are excluded
+	zones, err = s.holderZones(context.Background(), []Holder{{ID: "a", Zone: "a"}}, "a")
+	assert.Nil(t, err)
+	assert.Empty(t, zones)
+}